@@ -0,0 +1,332 @@
+package parser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ArchiveLoader loads all templates from a zip or tar.gz bundle.
+// When the archive file is replaced, the whole set of templates is swapped
+// atomically, so readers never observe a mix of two bundle versions.
+type ArchiveLoader struct {
+	path         string
+	extension    string
+	pollInterval atomic.Int64 // time.Duration
+	checkedAt    atomic.Int64 // Unix nanoseconds of the last file check
+	bundle       atomic.Pointer[templateBundle]
+	reloadMu     sync.Mutex
+}
+
+// templateBundle is an immutable snapshot of an archive's templates.
+// It implements TemplateLoader so a compile can resolve all partials against one bundle.
+type templateBundle struct {
+	templates map[string]string
+	hashes    map[string]string
+	modified  map[string]time.Time
+	fileState fileState
+}
+
+// NewArchiveLoader creates a loader for the archive at path and reads it immediately.
+// Only entries ending with extension are loaded (an empty extension matches all entries),
+// and template names are the entry paths without the extension.
+func NewArchiveLoader(path, extension string) (*ArchiveLoader, error) {
+	loader := &ArchiveLoader{
+		path:      path,
+		extension: extension,
+	}
+	loader.pollInterval.Store(int64(DefaultPollInterval))
+
+	if err := loader.Reload(); err != nil {
+		return nil, err
+	}
+
+	return loader, nil
+}
+
+// SetPollInterval sets how often the archive file is checked for changes
+func (a *ArchiveLoader) SetPollInterval(interval time.Duration) {
+	if interval > 0 {
+		a.pollInterval.Store(int64(interval))
+	}
+}
+
+// Snapshot implements SnapshotLoader. The returned loader serves the current
+// bundle and never changes, so a template and its partials compiled through it
+// always come from the same archive version.
+func (a *ArchiveLoader) Snapshot() TemplateLoader {
+	a.refresh()
+	return a.bundle.Load()
+}
+
+// Load implements TemplateLoader
+func (a *ArchiveLoader) Load(name string) (string, error) {
+	return a.Snapshot().Load(name)
+}
+
+// List implements TemplateLoader
+func (a *ArchiveLoader) List() ([]string, error) {
+	return a.Snapshot().List()
+}
+
+// Watch implements TemplateLoader by polling the archive file. After a new
+// bundle is loaded, the callback is invoked for every template that was added,
+// removed or whose content hash changed.
+func (a *ArchiveLoader) Watch(ctx context.Context, callback func(name string)) error {
+	interval := time.Duration(a.pollInterval.Load())
+	previous := a.bundle.Load()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.checkFile()
+
+				current := a.bundle.Load()
+				if current == previous {
+					continue
+				}
+
+				for name, hash := range current.hashes {
+					if previous.hashes[name] != hash {
+						callback(name)
+					}
+				}
+				for name := range previous.hashes {
+					if _, exists := current.hashes[name]; !exists {
+						callback(name)
+					}
+				}
+
+				previous = current
+			}
+		}
+	}()
+
+	return nil
+}
+
+// LastModified implements TemplateLoader.
+// A template keeps its modification time across bundle swaps as long as its content is unchanged.
+func (a *ArchiveLoader) LastModified(name string) (time.Time, error) {
+	return a.Snapshot().LastModified(name)
+}
+
+// Reload reads the archive file and atomically swaps in the new bundle
+func (a *ArchiveLoader) Reload() error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	a.checkedAt.Store(time.Now().UnixNano())
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+
+	templates, err := a.readArchive(data)
+	if err != nil {
+		return err
+	}
+
+	previous := a.bundle.Load()
+	now := time.Now()
+	bundle := &templateBundle{
+		templates: templates,
+		hashes:    make(map[string]string, len(templates)),
+		modified:  make(map[string]time.Time, len(templates)),
+		fileState: fileState{modTime: info.ModTime(), size: info.Size()},
+	}
+
+	for name, content := range templates {
+		sum := sha256.Sum256([]byte(content))
+		hash := hex.EncodeToString(sum[:])
+		bundle.hashes[name] = hash
+
+		if previous != nil && previous.hashes[name] == hash {
+			bundle.modified[name] = previous.modified[name]
+		} else {
+			bundle.modified[name] = now
+		}
+	}
+
+	a.bundle.Store(bundle)
+	return nil
+}
+
+// refresh checks the archive file at most once per poll interval
+func (a *ArchiveLoader) refresh() {
+	checkedAt := a.checkedAt.Load()
+	if time.Since(time.Unix(0, checkedAt)) < time.Duration(a.pollInterval.Load()) {
+		return
+	}
+	// Only one caller checks the file per interval, the others keep using the current bundle
+	if a.checkedAt.CompareAndSwap(checkedAt, time.Now().UnixNano()) {
+		a.checkFile()
+	}
+}
+
+// checkFile reloads the archive if the file on disk changed. Errors keep the
+// current bundle in place, so a partially written archive is never served.
+func (a *ArchiveLoader) checkFile() {
+	a.checkedAt.Store(time.Now().UnixNano())
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return
+	}
+
+	current := a.bundle.Load().fileState
+	if info.ModTime().Equal(current.modTime) && info.Size() == current.size {
+		return
+	}
+
+	if err := a.Reload(); err != nil {
+		slog.Warn("Failed to reload template archive", "path", a.path, "error", err)
+	}
+}
+
+// Load implements TemplateLoader
+func (b *templateBundle) Load(name string) (string, error) {
+	content, exists := b.templates[name]
+	if !exists {
+		return "", ErrTemplateNotFound
+	}
+	return content, nil
+}
+
+// List implements TemplateLoader
+func (b *templateBundle) List() ([]string, error) {
+	names := make([]string, 0, len(b.templates))
+	for name := range b.templates {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Watch implements TemplateLoader (no-op, a bundle never changes)
+func (b *templateBundle) Watch(ctx context.Context, callback func(name string)) error {
+	return nil
+}
+
+// LastModified implements TemplateLoader
+func (b *templateBundle) LastModified(name string) (time.Time, error) {
+	lastMod, exists := b.modified[name]
+	if !exists {
+		return time.Time{}, ErrTemplateNotFound
+	}
+	return lastMod, nil
+}
+
+// readArchive extracts the matching templates from zip or tar.gz data
+func (a *ArchiveLoader) readArchive(data []byte) (map[string]string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return a.readZip(data)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return a.readTarGz(data)
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", a.path)
+	}
+}
+
+// readZip extracts templates from a zip archive
+func (a *ArchiveLoader) readZip(data []byte) (map[string]string, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make(map[string]string)
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		name, ok := a.templateName(file.Name)
+		if !ok {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		templates[name] = string(content)
+	}
+
+	return templates, nil
+}
+
+// readTarGz extracts templates from a gzip compressed tar archive
+func (a *ArchiveLoader) readTarGz(data []byte) (map[string]string, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	templates := make(map[string]string)
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, ok := a.templateName(header.Name)
+		if !ok {
+			continue
+		}
+
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		templates[name] = string(content)
+	}
+
+	return templates, nil
+}
+
+// templateName maps an archive entry path to a template name
+func (a *ArchiveLoader) templateName(entry string) (string, bool) {
+	entry = strings.TrimPrefix(path.Clean("/"+entry), "/")
+	if entry == "" || !strings.HasSuffix(entry, a.extension) {
+		return "", false
+	}
+	return strings.TrimSuffix(entry, a.extension), true
+}
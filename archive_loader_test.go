@@ -0,0 +1,234 @@
+package parser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func writeZipBundle(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add archive entry: %v", err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	f.Close()
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Failed to replace archive: %v", err)
+	}
+}
+
+func writeTarGzBundle(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+}
+
+// Test archive loader with zip and tar.gz bundles
+func TestArchiveLoader(t *testing.T) {
+	files := map[string]string{
+		"greeting.tmpl":      "Hello",
+		"orders/create.tmpl": "Create",
+		"README.md":          "ignored",
+	}
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "bundle.zip")
+	tarPath := filepath.Join(dir, "bundle.tar.gz")
+	writeZipBundle(t, zipPath, files)
+	writeTarGzBundle(t, tarPath, files)
+
+	for _, path := range []string{zipPath, tarPath} {
+		loader, err := NewArchiveLoader(path, ".tmpl")
+		if err != nil {
+			t.Fatalf("Failed to create archive loader for %s: %v", path, err)
+		}
+
+		content, err := loader.Load("orders/create")
+		if err != nil {
+			t.Fatalf("Failed to load template from %s: %v", path, err)
+		}
+		if content != "Create" {
+			t.Errorf("Expected 'Create', got '%s'", content)
+		}
+
+		names, _ := loader.List()
+		sort.Strings(names)
+		if len(names) != 2 || names[0] != "greeting" || names[1] != "orders/create" {
+			t.Errorf("Expected [greeting orders/create], got %v", names)
+		}
+
+		if _, err := loader.Load("README"); err != ErrTemplateNotFound {
+			t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+		}
+	}
+
+	if _, err := NewArchiveLoader(filepath.Join(dir, "missing.zip"), ".tmpl"); err == nil {
+		t.Error("Expected error for missing archive")
+	}
+}
+
+// Test archive loader swaps bundles and reports changed templates
+func TestArchiveLoaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bundle.zip")
+	writeZipBundle(t, path, map[string]string{
+		"same.tmpl":    "unchanged",
+		"changed.tmpl": "v1",
+		"removed.tmpl": "bye",
+	})
+
+	loader, err := NewArchiveLoader(path, ".tmpl")
+	if err != nil {
+		t.Fatalf("Failed to create archive loader: %v", err)
+	}
+	loader.SetPollInterval(10 * time.Millisecond)
+
+	sameModified, _ := loader.LastModified("same")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan string, 10)
+	if err := loader.Watch(ctx, func(name string) { changes <- name }); err != nil {
+		t.Fatalf("Failed to start watching: %v", err)
+	}
+
+	writeZipBundle(t, path, map[string]string{
+		"same.tmpl":    "unchanged",
+		"changed.tmpl": "v2",
+		"added.tmpl":   "new",
+	})
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+
+	expected := map[string]bool{"changed": false, "removed": false, "added": false}
+	timeout := time.After(2 * time.Second)
+	for remaining := len(expected); remaining > 0; {
+		select {
+		case name := <-changes:
+			seen, ok := expected[name]
+			if !ok {
+				t.Errorf("Unexpected change notification for '%s'", name)
+				continue
+			}
+			if !seen {
+				expected[name] = true
+				remaining--
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for change notifications, got %v", expected)
+		}
+	}
+
+	content, err := loader.Load("changed")
+	if err != nil || content != "v2" {
+		t.Errorf("Expected 'v2', got '%s' (%v)", content, err)
+	}
+	if _, err := loader.Load("removed"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound for removed template, got %v", err)
+	}
+
+	if lastMod, _ := loader.LastModified("same"); !lastMod.Equal(sameModified) {
+		t.Errorf("Expected unchanged template to keep its modification time")
+	}
+}
+
+// Test archive loader keeps the previous bundle when the new archive is invalid
+func TestArchiveLoaderInvalidReplacement(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bundle.zip")
+	writeZipBundle(t, path, map[string]string{"greeting.tmpl": "Hello"})
+
+	loader, err := NewArchiveLoader(path, ".tmpl")
+	if err != nil {
+		t.Fatalf("Failed to create archive loader: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("not an archive"), 0o644); err != nil {
+		t.Fatalf("Failed to overwrite archive: %v", err)
+	}
+
+	content, err := loader.Load("greeting")
+	if err != nil || content != "Hello" {
+		t.Errorf("Expected previous bundle to be served, got '%s' (%v)", content, err)
+	}
+}
+
+// Test archive snapshots stay on one bundle version
+func TestArchiveLoaderSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bundle.zip")
+	writeZipBundle(t, path, map[string]string{
+		"page.tmpl":   `{{template "header" .}}body`,
+		"header.tmpl": "v1 ",
+	})
+
+	loader, err := NewArchiveLoader(path, ".tmpl")
+	if err != nil {
+		t.Fatalf("Failed to create archive loader: %v", err)
+	}
+	loader.SetPollInterval(time.Hour)
+	snapshot := loader.Snapshot()
+
+	writeZipBundle(t, path, map[string]string{
+		"page.tmpl":   `{{template "header" .}}body`,
+		"header.tmpl": "v2 ",
+	})
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+
+	// The file is not checked again within the poll interval
+	if content, _ := loader.Load("header"); content != "v1 " {
+		t.Errorf("Expected 'v1 ' within the poll interval, got '%s'", content)
+	}
+
+	if err := loader.Reload(); err != nil {
+		t.Fatalf("Failed to reload archive: %v", err)
+	}
+	if content, _ := loader.Load("header"); content != "v2 " {
+		t.Errorf("Expected 'v2 ' after reload, got '%s'", content)
+	}
+	if content, _ := snapshot.Load("header"); content != "v1 " {
+		t.Errorf("Expected snapshot to keep 'v1 ', got '%s'", content)
+	}
+
+	// Templates compiled through the cache use the current bundle throughout
+	cache := NewTemplateCache(10, nil)
+	tmpl, err := cache.Get("page", loader)
+	if err != nil {
+		t.Fatalf("Failed to compile template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil || buf.String() != "v2 body" {
+		t.Errorf("Expected 'v2 body', got '%s' (%v)", buf.String(), err)
+	}
+}
@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// BodyDecoder decodes a request body into a value exposed to templates as
+// RequestData.Parsed. The body has already been decompressed and transcoded
+// to UTF-8; contentType is the full Content-Type header including parameters.
+type BodyDecoder interface {
+	Decode(body []byte, contentType string) (interface{}, error)
+}
+
+// BodyDecoderFunc adapts a function to the BodyDecoder interface
+type BodyDecoderFunc func(body []byte, contentType string) (interface{}, error)
+
+// Decode implements BodyDecoder
+func (f BodyDecoderFunc) Decode(body []byte, contentType string) (interface{}, error) {
+	return f(body, contentType)
+}
+
+// JSONDecoder is the built-in decoder for application/json and +json media types.
+// Objects are also exposed as RequestData.BodyJSON and any value as BodyJSONValue.
+type JSONDecoder struct {
+	// UseNumber decodes numbers as json.Number instead of float64
+	UseNumber bool
+}
+
+// Decode implements BodyDecoder
+func (d JSONDecoder) Decode(body []byte, contentType string) (interface{}, error) {
+	var value interface{}
+	if !d.UseNumber {
+		err := json.Unmarshal(body, &value)
+		return value, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	// Reject trailing data the same way json.Unmarshal does
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid character after top-level value")
+	}
+	return value, nil
+}
+
+// XMLDecoder is the built-in decoder for XML media types and +xml media types.
+// The result is also exposed as RequestData.BodyXML.
+type XMLDecoder struct {
+	XMLOptions
+}
+
+// Decode implements BodyDecoder
+func (d XMLDecoder) Decode(body []byte, contentType string) (interface{}, error) {
+	return parseXMLWithOptions(string(body), d.XMLOptions, true)
+}
+
+// mediaType returns the lower-cased media type of a Content-Type header without parameters
+func mediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// structuredSuffix returns the structured syntax suffix of a media type, e.g.
+// "+json" for "application/problem+json", or "" if there is none
+func structuredSuffix(mt string) string {
+	if i := strings.LastIndex(mt, "+"); i >= 0 && !strings.Contains(mt[i:], "/") {
+		return mt[i:]
+	}
+	return ""
+}
+
+// isXMLContentType reports whether contentType is an XML media type
+func isXMLContentType(contentType string) bool {
+	mt := mediaType(contentType)
+	for _, ct := range xmlContentTypes {
+		if mt == ct {
+			return true
+		}
+	}
+	return structuredSuffix(mt) == "+xml"
+}
+
+// isJSONContentType reports whether contentType is a JSON media type
+func isJSONContentType(contentType string) bool {
+	mt := mediaType(contentType)
+	return mt == "application/json" || structuredSuffix(mt) == "+json"
+}
+
+// findBodyDecoder returns the decoder for contentType. Decoders registered for the
+// exact media type take precedence over those registered for its structured
+// syntax suffix, which take precedence over the built-in decoders.
+func findBodyDecoder(contentType string, options ExtractOptions) BodyDecoder {
+	mt := mediaType(contentType)
+	if mt == "" {
+		return nil
+	}
+
+	if decoder := lookupDecoder(options.BodyDecoders, mt); decoder != nil {
+		return decoder
+	}
+	if suffix := structuredSuffix(mt); suffix != "" {
+		if decoder := lookupDecoder(options.BodyDecoders, suffix); decoder != nil {
+			return decoder
+		}
+	}
+
+	switch {
+	case isNDJSONContentType(contentType):
+		return NDJSONDecoder{UseNumber: options.UseJSONNumber}
+	case isJSONContentType(contentType):
+		return JSONDecoder{UseNumber: options.UseJSONNumber}
+	case isXMLContentType(contentType):
+		return XMLDecoder{XMLOptions: options.XML}
+	case isYAMLContentType(contentType):
+		return YAMLDecoder{}
+	case isTOMLContentType(contentType):
+		return TOMLDecoder{}
+	case isCSVContentType(contentType):
+		return CSVDecoder{CSVOptions: options.CSV}
+	}
+	return nil
+}
+
+// lookupDecoder finds a decoder by case-insensitive key
+func lookupDecoder(decoders map[string]BodyDecoder, key string) BodyDecoder {
+	if decoder, ok := decoders[key]; ok {
+		return decoder
+	}
+	for k, decoder := range decoders {
+		if strings.EqualFold(k, key) {
+			return decoder
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Test registered decoders populate Parsed
+func TestBodyDecoderRegistry(t *testing.T) {
+	lines := BodyDecoderFunc(func(body []byte, contentType string) (interface{}, error) {
+		return strings.Split(strings.TrimSpace(string(body)), "\n"), nil
+	})
+	decoders := map[string]BodyDecoder{"Text/Lines": lines}
+
+	data := extractRequest(t, Config{BodyDecoders: decoders}, newBodyRequest("text/lines; charset=utf-8", "a\nb\n"))
+	parsed, ok := data.Parsed.([]string)
+	if !ok || len(parsed) != 2 || parsed[1] != "b" {
+		t.Errorf("Expected parsed lines, got %#v", data.Parsed)
+	}
+	if data.BodyJSON != nil || data.BodyXML != nil {
+		t.Error("Expected custom decoder not to populate BodyJSON or BodyXML")
+	}
+
+	// Unregistered media types are not decoded
+	data = extractRequest(t, Config{BodyDecoders: decoders}, newBodyRequest("text/plain", "a\nb\n"))
+	if data.Parsed != nil {
+		t.Errorf("Expected no parsed value, got %#v", data.Parsed)
+	}
+}
+
+// Test structured syntax suffixes use the built-in decoders
+func TestBodyDecoderStructuredSuffix(t *testing.T) {
+	data := extractRequest(t, Config{}, newBodyRequest("application/problem+json", `{"title":"Not Found"}`))
+	if data.BodyJSON["title"] != "Not Found" {
+		t.Errorf("Expected +json body in BodyJSON, got %v", data.BodyJSON)
+	}
+	if parsed, ok := data.Parsed.(map[string]interface{}); !ok || parsed["title"] != "Not Found" {
+		t.Errorf("Expected +json body in Parsed, got %v", data.Parsed)
+	}
+
+	data = extractRequest(t, Config{}, newBodyRequest("application/atom+xml", `<feed><title>News</title></feed>`))
+	if data.BodyXML == nil || data.Parsed == nil {
+		t.Errorf("Expected +xml body in BodyXML and Parsed, got %v %v", data.BodyXML, data.Parsed)
+	}
+
+	// Media types that merely start with application/json are not JSON
+	data = extractRequest(t, Config{}, newBodyRequest("application/json-seq", `{"a":1}`))
+	if data.BodyJSON != nil {
+		t.Errorf("Expected application/json-seq not to be decoded, got %v", data.BodyJSON)
+	}
+}
+
+// Test exact media type registrations take precedence over suffix registrations
+func TestBodyDecoderPrecedence(t *testing.T) {
+	named := func(name string) BodyDecoder {
+		return BodyDecoderFunc(func(body []byte, contentType string) (interface{}, error) {
+			return name, nil
+		})
+	}
+	decoders := map[string]BodyDecoder{
+		"+json":                    named("suffix"),
+		"application/vnd.api+json": named("exact"),
+	}
+
+	if data := extractRequest(t, Config{BodyDecoders: decoders}, newBodyRequest("application/vnd.api+json", `{}`)); data.Parsed != "exact" {
+		t.Errorf("Expected exact decoder, got %v", data.Parsed)
+	}
+	if data := extractRequest(t, Config{BodyDecoders: decoders}, newBodyRequest("application/ld+json", `{}`)); data.Parsed != "suffix" {
+		t.Errorf("Expected suffix decoder, got %v", data.Parsed)
+	}
+	if data := extractRequest(t, Config{BodyDecoders: decoders}, newBodyRequest("application/json", `{"a":1}`)); data.BodyJSON["a"] != float64(1) {
+		t.Errorf("Expected built-in JSON decoder, got %v", data.Parsed)
+	}
+
+	// Built-in decoders can be registered for other media types
+	decoders = map[string]BodyDecoder{"application/x-amz-json-1.1": JSONDecoder{}}
+	if data := extractRequest(t, Config{BodyDecoders: decoders}, newBodyRequest("application/x-amz-json-1.1", `{"a":1}`)); data.BodyJSON["a"] != float64(1) {
+		t.Errorf("Expected registered JSONDecoder to populate BodyJSON, got %v", data.BodyJSON)
+	}
+}
+
+// Test templates can use Parsed
+func TestParseWithParsedBody(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("parsed", `{{.Parsed.name}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(`{"name":"parsed"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	var buf bytes.Buffer
+	if _, err := p.Parse("parsed", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "parsed" {
+		t.Errorf("Expected 'parsed', got '%s'", buf.String())
+	}
+}
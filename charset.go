@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// xmlEncodingDecl matches the encoding attribute of an XML declaration
+var xmlEncodingDecl = regexp.MustCompile(`^\s*<\?xml[^>]*?\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// decodeCharset transcodes a body of a text media type to UTF-8. The charset is
+// taken from a byte order mark, the charset parameter of contentType or, for XML
+// bodies, the encoding declaration, in that order. It returns the charset that
+// was applied, or "" if the body was left unchanged. Binary bodies are never
+// transcoded.
+func decodeCharset(body []byte, contentType string) ([]byte, string, error) {
+	if len(body) == 0 || !isTextContentType(contentType) {
+		return body, "", nil
+	}
+
+	label, enc := bomEncoding(body)
+	if enc == nil {
+		label = charsetFromContentType(contentType)
+		if label == "" && isXMLContentType(contentType) {
+			label = xmlDeclaredEncoding(body)
+		}
+		if label == "" {
+			return body, "", nil
+		}
+
+		var err error
+		if enc, err = lookupCharset(label); err != nil {
+			return body, "", err
+		}
+	}
+
+	if enc == unicode.UTF8 {
+		return bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), "", nil
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, "", fmt.Errorf("decoding %s body: %w", label, err)
+	}
+	return decoded, label, nil
+}
+
+// isTextContentType reports whether contentType is a text media type or a text
+// format such as JSON, XML, YAML, TOML, CSV or form data
+func isTextContentType(contentType string) bool {
+	mt := mediaType(contentType)
+	return strings.HasPrefix(mt, "text/") || mt == "application/x-www-form-urlencoded" ||
+		isJSONContentType(contentType) || isNDJSONContentType(contentType) ||
+		isXMLContentType(contentType) || isYAMLContentType(contentType) ||
+		isTOMLContentType(contentType) || isCSVContentType(contentType)
+}
+
+// isUTF8ContentType reports whether contentType is a media type that is UTF-8 by
+// definition, so that a body with an unknown charset is decoded as received
+func isUTF8ContentType(contentType string) bool {
+	return isJSONContentType(contentType) || isNDJSONContentType(contentType)
+}
+
+// bomEncoding returns the encoding indicated by a UTF-8 or UTF-16 byte order mark
+func bomEncoding(body []byte) (string, encoding.Encoding) {
+	switch {
+	case bytes.HasPrefix(body, []byte("\xef\xbb\xbf")):
+		return "utf-8", unicode.UTF8
+	case bytes.HasPrefix(body, []byte("\xfe\xff")):
+		return "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(body, []byte("\xff\xfe")):
+		return "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	}
+	return "", nil
+}
+
+// charsetFromContentType returns the lower-cased charset parameter of a Content-Type header
+func charsetFromContentType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(params["charset"]))
+}
+
+// xmlDeclaredEncoding returns the encoding named in an XML declaration, if any
+func xmlDeclaredEncoding(body []byte) string {
+	if len(body) > 512 {
+		body = body[:512]
+	}
+	match := xmlEncodingDecl.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(string(match[1]))
+}
+
+// lookupCharset resolves a charset label using the WHATWG encoding labels,
+// falling back to the IANA registry
+func lookupCharset(label string) (encoding.Encoding, error) {
+	if enc, err := htmlindex.Get(label); err == nil {
+		return enc, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(label)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported charset: %s", label)
+	}
+	return enc, nil
+}
+
+// xmlCharsetReader returns an xml.Decoder CharsetReader. Content that has
+// already been transcoded to UTF-8 is passed through, since its declared encoding
+// no longer applies. Otherwise only UTF-8 declarations are accepted, so content
+// in another or an unknown encoding fails instead of being read as UTF-8.
+func xmlCharsetReader(transcoded bool) func(charset string, input io.Reader) (io.Reader, error) {
+	return func(charset string, input io.Reader) (io.Reader, error) {
+		if transcoded {
+			return input, nil
+		}
+		if enc, err := lookupCharset(charset); err == nil && enc == unicode.UTF8 {
+			return input, nil
+		}
+		return nil, fmt.Errorf("unsupported XML encoding %q: content was not transcoded to UTF-8", charset)
+	}
+}
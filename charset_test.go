@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Test Latin-1 XML declared in the Content-Type header
+func TestExtractLatin1XML(t *testing.T) {
+	xmlBody, _ := charmap.ISO8859_1.NewEncoder().String(`<?xml version="1.0" encoding="ISO-8859-1"?><name>José</name>`)
+
+	data := extractRequest(t, Config{}, newBodyRequest("text/xml; charset=ISO-8859-1", xmlBody))
+	name, ok := data.BodyXML["name"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected BodyXML to be parsed, got %v", data.BodyXML)
+	}
+	if name["name"] != "José" {
+		t.Errorf("Expected 'José', got %v", name["name"])
+	}
+	if data.Body != `<?xml version="1.0" encoding="ISO-8859-1"?><name>José</name>` {
+		t.Errorf("Expected UTF-8 body, got %q", data.Body)
+	}
+}
+
+// Test Windows-1252 XML declared only in the XML declaration
+func TestExtractWindows1252XMLDeclaration(t *testing.T) {
+	xmlBody, _ := charmap.Windows1252.NewEncoder().String(`<?xml version="1.0" encoding="windows-1252"?><price>€10 “net”</price>`)
+
+	data := extractRequest(t, Config{}, newBodyRequest("application/soap+xml", xmlBody))
+	price, ok := data.BodyXML["price"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected BodyXML to be parsed, got %v", data.BodyXML)
+	}
+	if price["price"] != "€10 “net”" {
+		t.Errorf("Expected '€10 “net”', got %v", price["price"])
+	}
+}
+
+// Test UTF-16 JSON with and without a byte order mark
+func TestExtractUTF16JSON(t *testing.T) {
+	withBOM, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(`{"city":"Zürich"}`)
+	data := extractRequest(t, Config{}, newBodyRequest("application/json", withBOM))
+	if data.BodyJSON["city"] != "Zürich" {
+		t.Errorf("Expected 'Zürich' from BOM-detected body, got %v", data.BodyJSON)
+	}
+
+	bigEndian, _ := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder().String(`{"city":"Zürich"}`)
+	data = extractRequest(t, Config{}, newBodyRequest("application/json; charset=UTF-16BE", bigEndian))
+	if data.BodyJSON["city"] != "Zürich" {
+		t.Errorf("Expected 'Zürich' from declared charset, got %v", data.BodyJSON)
+	}
+}
+
+// Test charset resolution edge cases
+func TestDecodeCharset(t *testing.T) {
+	body := []byte("caf\xe9")
+
+	if decoded, charset, err := decodeCharset(body, "text/plain; charset=windows-1250"); err != nil || string(decoded) != "café" || charset != "windows-1250" {
+		t.Errorf("Expected 'café' from windows-1250, got %q %q (%v)", decoded, charset, err)
+	}
+
+	if decoded, charset, err := decodeCharset(body, "text/plain"); err != nil || !bytes.Equal(decoded, body) || charset != "" {
+		t.Errorf("Expected body without charset to be unchanged, got %q %q (%v)", decoded, charset, err)
+	}
+
+	if decoded, _, err := decodeCharset(body, "text/plain; charset=x-unknown"); err == nil || !bytes.Equal(decoded, body) {
+		t.Errorf("Expected error and unchanged body for unknown charset, got %q (%v)", decoded, err)
+	}
+
+	if decoded, _, err := decodeCharset([]byte("\xef\xbb\xbfok"), "text/plain; charset=iso-8859-1"); err != nil || string(decoded) != "ok" {
+		t.Errorf("Expected byte order mark to take precedence, got %q (%v)", decoded, err)
+	}
+
+	// Binary bodies are left alone, even when they start like a byte order mark
+	binary := []byte("\xff\xfe\x00\x01")
+	if decoded, charset, err := decodeCharset(binary, "application/octet-stream"); err != nil || !bytes.Equal(decoded, binary) || charset != "" {
+		t.Errorf("Expected binary body to be unchanged, got %q %q (%v)", decoded, charset, err)
+	}
+}
+
+// Test JSON with an unknown charset is decoded as received
+func TestExtractJSONUnknownCharset(t *testing.T) {
+	data := extractRequest(t, Config{}, newBodyRequest("application/json; charset=utf8mb4", `{"a":1}`))
+	if data.BodyJSON["a"] != float64(1) {
+		t.Errorf("Expected BodyJSON map[a:1], got %v", data.BodyJSON)
+	}
+
+	binary := "\xff\xfe\x00\x01"
+	data = extractRequest(t, Config{}, newBodyRequest("application/octet-stream", binary))
+	if data.Body != binary {
+		t.Errorf("Expected binary body to be kept as received, got %q", data.Body)
+	}
+}
+
+// Test XML in an unknown or untranscoded encoding is rejected instead of read as UTF-8
+func TestXMLUnsupportedEncoding(t *testing.T) {
+	body := []byte(`<?xml version="1.0" encoding="x-unknown"?><name>Jos` + "\xe9" + `</name>`)
+	data := extractRequest(t, Config{}, newBodyRequest("application/xml", string(body)))
+	if data.BodyXML != nil || data.XMLDoc != nil || data.Parsed != nil {
+		t.Errorf("Expected body in unknown encoding not to be parsed, got %v", data.BodyXML)
+	}
+	if data.Body != string(body) {
+		t.Errorf("Expected body to be kept as received, got %q", data.Body)
+	}
+
+	// Content that was not transcoded must be UTF-8
+	if _, err := FromXML(`<?xml version="1.0" encoding="ISO-8859-1"?><a>1</a>`, XMLConvertOptions{}); err == nil {
+		t.Error("Expected error for ISO-8859-1 declaration on untranscoded content")
+	}
+	if _, err := FromXML(`<?xml version="1.0" encoding="utf8"?><a>1</a>`, XMLConvertOptions{}); err != nil {
+		t.Errorf("Expected UTF-8 declaration to be accepted, got %v", err)
+	}
+}
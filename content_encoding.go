@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultMaxDecodedBodyBytes is the default limit for decompressed request bodies
+const DefaultMaxDecodedBodyBytes = 64 << 20 // 64 MB
+
+// decodeContentEncoding decodes body according to a Content-Encoding header value.
+// Encodings are undone in reverse order of application. The decoded size is
+// limited to maxBytes to protect against decompression bombs.
+func decodeContentEncoding(body []byte, contentEncoding string, maxBytes int64) ([]byte, error) {
+	encodings := strings.Split(contentEncoding, ",")
+
+	decoded := body
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "" || encoding == "identity" {
+			continue
+		}
+
+		reader, err := newDecompressor(encoding, bytes.NewReader(decoded))
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, err = io.ReadAll(io.LimitReader(reader, maxBytes+1))
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s body: %w", encoding, err)
+		}
+		if int64(len(decoded)) > maxBytes {
+			return nil, fmt.Errorf("%w: decompressed body exceeds %d bytes", ErrBodyTooLarge, maxBytes)
+		}
+	}
+
+	return decoded, nil
+}
+
+// newContentDecodingReader returns a reader that decodes r according to a
+// Content-Encoding header value as it is read, and the decompressors to close
+// once reading is done
+func newContentDecodingReader(r io.Reader, contentEncoding string) (io.Reader, []io.Closer, error) {
+	encodings := strings.Split(contentEncoding, ",")
+
+	var closers []io.Closer
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "" || encoding == "identity" {
+			continue
+		}
+
+		reader, err := newDecompressor(encoding, r)
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			return nil, nil, err
+		}
+		closers = append(closers, reader)
+		r = reader
+	}
+
+	return r, closers, nil
+}
+
+// newDecompressor returns a reader that decodes the given content coding
+func newDecompressor(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// HTTP deflate is zlib-wrapped, but some clients send raw deflate data
+		br := bufio.NewReader(r)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
+// isZlibHeader reports whether header starts a zlib stream using deflate
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && header[1]&0x20 == 0 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
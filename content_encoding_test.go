@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func compressBody(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("Failed to create zstd writer: %v", err)
+		}
+		w = zw
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// Test compressed bodies are decoded before extraction
+func TestExtractCompressedBody(t *testing.T) {
+	jsonBody := []byte(`{"name":"compressed"}`)
+
+	for _, encoding := range []string{"gzip", "deflate", "br", "zstd"} {
+		compressed := compressBody(t, encoding, jsonBody)
+		req, _ := http.NewRequest("POST", "http://example.com/", bytes.NewReader(compressed))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", encoding)
+
+		rereadable, err := NewRereadableRequest(req)
+		if err != nil {
+			t.Fatalf("%s: failed to create re-readable request: %v", encoding, err)
+		}
+		data, err := rereadable.Extract()
+		if err != nil {
+			t.Fatalf("%s: failed to extract request data: %v", encoding, err)
+		}
+
+		if data.Body != string(jsonBody) {
+			t.Errorf("%s: expected decoded body, got %q", encoding, data.Body)
+		}
+		if data.BodyJSON["name"] != "compressed" {
+			t.Errorf("%s: expected BodyJSON to be parsed, got %v", encoding, data.BodyJSON)
+		}
+
+		// The original bytes stay available for pass-through
+		if !bytes.Equal(rereadable.RawBodyBytes(), compressed) {
+			t.Errorf("%s: expected raw body to be the compressed bytes", encoding)
+		}
+		if raw, _ := io.ReadAll(req.Body); !bytes.Equal(raw, compressed) {
+			t.Errorf("%s: expected request body stream to stay compressed", encoding)
+		}
+	}
+}
+
+// Test stacked encodings and compressed form bodies
+func TestExtractCompressedForm(t *testing.T) {
+	body := compressBody(t, "br", compressBody(t, "gzip", []byte("name=value")))
+	req, _ := http.NewRequest("POST", "http://example.com/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Content-Encoding", "gzip, br")
+
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	data, err := p.Extract(req)
+	if err != nil {
+		t.Fatalf("Failed to extract request data: %v", err)
+	}
+	if len(data.Form["name"]) != 1 || data.Form["name"][0] != "value" {
+		t.Errorf("Expected form value 'value', got %v", data.Form)
+	}
+}
+
+// Test decompression respects the decoded size limit
+func TestExtractCompressedBodyLimit(t *testing.T) {
+	bomb := compressBody(t, "gzip", bytes.Repeat([]byte("0"), 1<<20))
+
+	req, _ := http.NewRequest("POST", "http://example.com/", bytes.NewReader(bomb))
+	req.Header.Set("Content-Encoding", "gzip")
+	if _, err := NewRereadableRequestWithOptions(req, ExtractOptions{MaxDecodedBodyBytes: 1024}); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Expected ErrBodyTooLarge, got %v", err)
+	}
+
+	req, _ = http.NewRequest("POST", "http://example.com/", bytes.NewReader(bomb))
+	req.Header.Set("Content-Encoding", "gzip")
+	rereadable, err := NewRereadableRequestWithOptions(req, ExtractOptions{DisableDecompression: true})
+	if err != nil {
+		t.Fatalf("Failed to create re-readable request: %v", err)
+	}
+	if rereadable.Decoded() || !bytes.Equal(rereadable.BodyBytes(), bomb) {
+		t.Error("Expected body to stay compressed when decompression is disabled")
+	}
+
+	// Corrupt data is kept as received
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader("not gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	rereadable, err = NewRereadableRequest(req)
+	if err != nil {
+		t.Fatalf("Expected corrupt body to be tolerated, got %v", err)
+	}
+	if rereadable.Body() != "not gzip" {
+		t.Errorf("Expected body as received, got %q", rereadable.Body())
+	}
+}
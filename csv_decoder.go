@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// CSVOptions controls how CSV and TSV bodies are decoded
+type CSVOptions struct {
+	// Comma is the field delimiter (0 = ',' for text/csv and '\t' for
+	// text/tab-separated-values)
+	Comma rune
+
+	// NoHeader treats the first row as data instead of column names. A
+	// "header=present" or "header=absent" Content-Type parameter takes precedence
+	NoHeader bool
+
+	// LazyQuotes allows quotes in unquoted fields and unescaped quotes in quoted fields
+	LazyQuotes bool
+
+	// TrimLeadingSpace ignores leading white space in fields
+	TrimLeadingSpace bool
+
+	// Comment starts lines that are skipped (0 = no comments)
+	Comment rune
+}
+
+// CSVTable is the result of decoding a CSV or TSV body
+type CSVTable struct {
+	// Header contains the column names, or nil when the body has no header row
+	Header []string
+
+	// Rows contains every row as read, including the header row
+	Rows [][]string
+
+	// Records contains the data rows keyed by column name. Missing fields are
+	// empty strings and fields beyond the header are dropped
+	Records []map[string]string
+}
+
+// CSVDecoder is the built-in decoder for text/csv and text/tab-separated-values.
+// It returns a *CSVTable; the rows are also exposed as RequestData.BodyCSV and
+// the records as RequestData.BodyCSVRecords and BodyRecords.
+type CSVDecoder struct {
+	CSVOptions
+}
+
+// Decode implements BodyDecoder
+func (d CSVDecoder) Decode(body []byte, contentType string) (interface{}, error) {
+	return d.decodeTable(body, contentType)
+}
+
+// decodeTable reads all rows of body and keys the data rows by the header
+func (d CSVDecoder) decodeTable(body []byte, contentType string) (*CSVTable, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.Comma = d.Comma
+	if reader.Comma == 0 {
+		reader.Comma = ','
+		if mediaType(contentType) == "text/tab-separated-values" {
+			reader.Comma = '\t'
+		}
+	}
+	reader.Comment = d.Comment
+	reader.LazyQuotes = d.LazyQuotes
+	reader.TrimLeadingSpace = d.TrimLeadingSpace
+	reader.FieldsPerRecord = -1
+
+	hasHeader := !d.NoHeader
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		switch strings.ToLower(params["header"]) {
+		case "present":
+			hasHeader = true
+		case "absent":
+			hasHeader = false
+		}
+	}
+
+	table := &CSVTable{}
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		table.Rows = append(table.Rows, row)
+
+		if hasHeader && table.Header == nil {
+			table.Header = row
+			continue
+		}
+		if table.Header != nil {
+			record := make(map[string]string, len(table.Header))
+			for i, name := range table.Header {
+				if i < len(row) {
+					record[name] = row[i]
+				} else {
+					record[name] = ""
+				}
+			}
+			table.Records = append(table.Records, record)
+		}
+	}
+
+	return table, nil
+}
+
+// isCSVContentType reports whether contentType is a CSV or TSV media type
+func isCSVContentType(contentType string) bool {
+	mt := mediaType(contentType)
+	return mt == "text/csv" || mt == "text/tab-separated-values"
+}
+
+// csvTableOf returns the decoded CSV table of source, which is either a
+// *CSVTable or the request data of a CSV or TSV body. It fails when the body
+// has no header row, since columns are looked up by name
+func csvTableOf(source interface{}) (*CSVTable, error) {
+	var table *CSVTable
+	switch s := source.(type) {
+	case *CSVTable:
+		table = s
+	case *RequestData:
+		if s != nil {
+			table, _ = s.Parsed.(*CSVTable)
+		}
+		if table == nil {
+			return nil, fmt.Errorf("request body is not CSV")
+		}
+	}
+	if table == nil {
+		return nil, fmt.Errorf("unsupported CSV source %T, expected the request data or a *CSVTable", source)
+	}
+	if table.Header == nil {
+		return nil, fmt.Errorf("CSV body has no header row")
+	}
+	return table, nil
+}
+
+// index returns the index of the named column in the header row, or -1
+func (t *CSVTable) index(name string) int {
+	for i, column := range t.Header {
+		if column == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// csvColumnIndex returns the index of the named column in the header row, or -1
+func csvColumnIndex(source interface{}, name string) (int, error) {
+	table, err := csvTableOf(source)
+	if err != nil {
+		return -1, err
+	}
+	return table.index(name), nil
+}
+
+// csvColumn returns the values of the named column for every data row.
+// Rows that are too short yield empty strings
+func csvColumn(source interface{}, name string) ([]string, error) {
+	table, err := csvTableOf(source)
+	if err != nil {
+		return nil, err
+	}
+	index := table.index(name)
+	if index < 0 {
+		return nil, nil
+	}
+	values := make([]string, 0, len(table.Rows)-1)
+	for _, row := range table.Rows[1:] {
+		if index < len(row) {
+			values = append(values, row[index])
+		} else {
+			values = append(values, "")
+		}
+	}
+	return values, nil
+}
+
+// csvHeader returns the header row
+func csvHeader(source interface{}) ([]string, error) {
+	table, err := csvTableOf(source)
+	if err != nil {
+		return nil, err
+	}
+	return table.Header, nil
+}
+
+// csvField returns the field of row for the named column, or "" if absent
+func csvField(source interface{}, row []string, name string) (string, error) {
+	table, err := csvTableOf(source)
+	if err != nil {
+		return "", err
+	}
+	index := table.index(name)
+	if index < 0 || index >= len(row) {
+		return "", nil
+	}
+	return row[index], nil
+}
@@ -0,0 +1,186 @@
+package parser
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const csvBody = "id,name,email\n1,Ada,ada@example.com\n2,\"Grace, H\",grace@example.com\n3,Linus\n"
+
+// Test CSV bodies are decoded into rows and header-keyed records
+func TestExtractCSV(t *testing.T) {
+	data := extractRequest(t, Config{}, newBodyRequest("text/csv; charset=utf-8", csvBody))
+
+	if len(data.BodyCSV) != 4 || !reflect.DeepEqual(data.BodyCSV[0], []string{"id", "name", "email"}) {
+		t.Fatalf("Expected 4 rows with header, got %v", data.BodyCSV)
+	}
+	if len(data.BodyCSVRecords) != 3 {
+		t.Fatalf("Expected 3 records, got %v", data.BodyCSVRecords)
+	}
+	if data.BodyCSVRecords[1]["name"] != "Grace, H" {
+		t.Errorf("Expected quoted field 'Grace, H', got %q", data.BodyCSVRecords[1]["name"])
+	}
+	if email, ok := data.BodyCSVRecords[2]["email"]; !ok || email != "" {
+		t.Errorf("Expected missing field to be empty, got %q", email)
+	}
+	if data.BodyRecords != nil {
+		t.Errorf("Expected BodyRecords to be NDJSON only, got %v", data.BodyRecords)
+	}
+	if table, ok := data.Parsed.(*CSVTable); !ok || len(table.Header) != 3 {
+		t.Errorf("Expected *CSVTable in Parsed, got %T", data.Parsed)
+	}
+
+	// TSV uses tabs, and the header parameter overrides the configuration
+	data = extractRequest(t, Config{}, newBodyRequest("text/tab-separated-values; header=absent", "a\tb\nc\td\n"))
+	if len(data.BodyCSV) != 2 || data.BodyCSV[1][1] != "d" || data.BodyCSVRecords != nil {
+		t.Errorf("Expected two data rows without records, got %v %v", data.BodyCSV, data.BodyCSVRecords)
+	}
+}
+
+// Test CSV options from Config
+func TestExtractCSVOptions(t *testing.T) {
+	p, err := NewParser(Config{CSV: CSVOptions{Comma: ';', NoHeader: true, LazyQuotes: true, Comment: '#'}})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("# export\n1;5\" screen\n2;ok\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	data, err := p.Extract(req)
+	if err != nil {
+		t.Fatalf("Failed to extract request data: %v", err)
+	}
+
+	expected := [][]string{{"1", `5" screen`}, {"2", "ok"}}
+	if !reflect.DeepEqual(data.BodyCSV, expected) {
+		t.Errorf("Expected %v, got %v", expected, data.BodyCSV)
+	}
+	if data.BodyCSVRecords != nil {
+		t.Errorf("Expected no records without a header, got %v", data.BodyCSVRecords)
+	}
+
+	// Strict quoting rejects the same body
+	if data := extractRequest(t, Config{}, newBodyRequest("text/csv", "1,5\" screen\n")); data.BodyCSV != nil {
+		t.Errorf("Expected malformed CSV to be ignored, got %v", data.BodyCSV)
+	}
+}
+
+// Test converting a CSV upload to JSON with a template
+func TestParseCSVToJSON(t *testing.T) {
+	p, err := NewGenericParser[[]map[string]string](Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `[{{range $i, $row := slice .BodyCSV 1}}{{if $i}},{{end}}{"user":"{{csvField $ $row "name"}}"}{{end}}]`
+	if err := p.UpdateTemplate("users", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("id,name\n1,Ada\n2,Linus\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	result, _, err := p.Parse("users", req)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if len(result) != 2 || result[1]["user"] != "Linus" {
+		t.Errorf("Unexpected result: %v", result)
+	}
+}
+
+// Test CSV column helpers
+func TestCSVFuncs(t *testing.T) {
+	rows := [][]string{{"id", "name"}, {"1", "Ada"}, {"2"}}
+	table := &CSVTable{Header: rows[0], Rows: rows}
+
+	if got, err := csvColumn(table, "name"); err != nil || !reflect.DeepEqual(got, []string{"Ada", ""}) {
+		t.Errorf("Expected [Ada ''], got %v (%v)", got, err)
+	}
+	if got, err := csvColumn(table, "missing"); err != nil || got != nil {
+		t.Errorf("Expected nil for missing column, got %v (%v)", got, err)
+	}
+	if got, err := csvColumnIndex(table, "name"); err != nil || got != 1 {
+		t.Errorf("Expected index 1, got %d (%v)", got, err)
+	}
+	if got, err := csvHeader(&RequestData{Parsed: table}); err != nil || !reflect.DeepEqual(got, rows[0]) {
+		t.Errorf("Expected header row, got %v (%v)", got, err)
+	}
+	if got, err := csvField(table, rows[1], "name"); err != nil || got != "Ada" {
+		t.Errorf("Expected 'Ada', got '%s' (%v)", got, err)
+	}
+	if _, err := csvHeader(rows); err == nil {
+		t.Error("Expected error for rows without a decoded table")
+	}
+	if _, err := csvHeader(&RequestData{}); err == nil {
+		t.Error("Expected error for request data without a CSV body")
+	}
+
+	// Records rendered per row from the template
+	parser, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer parser.Close()
+	if err := parser.UpdateTemplate("row", `{{range .BodyCSVRecords}}{{.name}};{{end}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(csvBody))
+	req.Header.Set("Content-Type", "text/csv")
+	var buf bytes.Buffer
+	if _, err := parser.Parse("row", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "Ada;Grace, H;Linus;" {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+}
+
+// Test CSV helpers fail instead of using the first data row as the header
+func TestCSVFuncsNoHeader(t *testing.T) {
+	p, err := NewParser(Config{CSV: CSVOptions{NoHeader: true}})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("field", `{{range .BodyCSV}}{{csvField $ . "1"}};{{end}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if err := p.UpdateTemplate("index", `{{index .BodyCSV 1 1}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	for _, contentType := range []string{"text/csv", "text/csv; header=absent"} {
+		req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("1,Ada\n2,Linus\n"))
+		req.Header.Set("Content-Type", contentType)
+		var buf bytes.Buffer
+		_, err := p.Parse("field", req, &buf)
+		if err == nil || !strings.Contains(err.Error(), "no header row") {
+			t.Errorf("Expected no header row error for %q, got %v (output %q)", contentType, err, buf.String())
+		}
+	}
+
+	// Rows stay available by position
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("1,Ada\n2,Linus\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	var buf bytes.Buffer
+	if _, err := p.Parse("index", req, &buf); err != nil || buf.String() != "Linus" {
+		t.Errorf("Expected 'Linus', got %q (%v)", buf.String(), err)
+	}
+
+	// The header parameter restores named columns
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader("id,name\n1,Ada\n"))
+	req.Header.Set("Content-Type", "text/csv; header=present")
+	buf.Reset()
+	if err := p.UpdateTemplate("column", `{{csvColumn . "name"}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if _, err := p.Parse("column", req, &buf); err != nil || buf.String() != "[Ada]" {
+		t.Errorf("Expected '[Ada]', got %q (%v)", buf.String(), err)
+	}
+}
@@ -4,8 +4,13 @@ import "errors"
 
 // Common errors
 var (
-	ErrTemplateNotFound = errors.New("template not found")
-	ErrWatcherClosed    = errors.New("file watcher is closed")
-	ErrInvalidConfig    = errors.New("invalid configuration")
-	ErrParserClosed     = errors.New("parser is closed")
+	ErrTemplateNotFound       = errors.New("template not found")
+	ErrWatcherClosed          = errors.New("file watcher is closed")
+	ErrInvalidConfig          = errors.New("invalid configuration")
+	ErrParserClosed           = errors.New("parser is closed")
+	ErrExecutionTimeout       = errors.New("template execution timed out")
+	ErrOutputTooLarge         = errors.New("template output too large")
+	ErrBodyTooLarge           = errors.New("request body too large")
+	ErrTemplateTooLarge       = errors.New("template too large")
+	ErrUnsupportedContentType = errors.New("unsupported content type")
 )
@@ -0,0 +1,247 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// contextWriter forwards writes until its context is done, which makes the
+// running template stop at its next output
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// Write implements io.Writer
+func (c *contextWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, contextError(err)
+	}
+	return c.w.Write(p)
+}
+
+// maxOutputBytesKey is the context key for the per-call output limit
+type maxOutputBytesKey struct{}
+
+// WithMaxOutputBytes returns a context that overrides Config.MaxOutputBytes for
+// ParseContext/ParseWithContext calls made with it (0 = unlimited)
+func WithMaxOutputBytes(ctx context.Context, limit int64) context.Context {
+	return context.WithValue(ctx, maxOutputBytesKey{}, limit)
+}
+
+// maxOutputBytesFrom returns the output limit set with WithMaxOutputBytes
+func maxOutputBytesFrom(ctx context.Context) (int64, bool) {
+	limit, ok := ctx.Value(maxOutputBytesKey{}).(int64)
+	return limit, ok
+}
+
+// limitWriter fails with ErrOutputTooLarge once more than limit bytes would be written
+type limitWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+}
+
+// Write implements io.Writer
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.written+int64(len(p)) > l.limit {
+		return 0, fmt.Errorf("%w: limit %d bytes", ErrOutputTooLarge, l.limit)
+	}
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	return n, err
+}
+
+// DefaultMaxRepeatBytes caps the result of the repeat function in parser
+// executions without an output limit or Config.MaxRepeatBytes
+const DefaultMaxRepeatBytes = 1 << 20
+
+// executionState is the state of the execution using a template instance
+type executionState struct {
+	ctx   context.Context
+	limit int64 // Output limit of the execution (0 = unlimited)
+}
+
+// executionFuncs create template functions bound to the state of one
+// execution, replacing the function of the same name in the function map
+type executionFuncs map[string]func(state *executionState) interface{}
+
+// repeatLimit returns the largest result repeat may produce: maxRepeat, or the
+// output limit of the execution when that is lower or maxRepeat is 0, or
+// DefaultMaxRepeatBytes when neither is set
+func repeatLimit(maxRepeat, outputLimit int64) int64 {
+	switch {
+	case maxRepeat <= 0 && outputLimit > 0:
+		return outputLimit
+	case maxRepeat <= 0:
+		return DefaultMaxRepeatBytes
+	case outputLimit > 0 && outputLimit < maxRepeat:
+		return outputLimit
+	}
+	return maxRepeat
+}
+
+// newRepeatFunc returns a repeat function whose results are capped at limit() bytes (0 = unlimited)
+func newRepeatFunc(limit func() int64) func(s string, count int) (string, error) {
+	return func(s string, count int) (string, error) {
+		if count <= 0 || s == "" {
+			return "", nil
+		}
+		if maxBytes := limit(); maxBytes > 0 && int64(count) > maxBytes/int64(len(s)) {
+			return "", fmt.Errorf("%w: repeat would produce more than %d bytes", ErrOutputTooLarge, maxBytes)
+		}
+		return strings.Repeat(s, count), nil
+	}
+}
+
+// templateInstance is a clone of a compiled template whose functions fail once
+// the context of the execution using it is done
+type templateInstance struct {
+	tmpl  Template
+	state *executionState
+}
+
+// templateExecutor executes a compiled template under a context.
+// Compiled templates are shared, so each execution with a context takes an
+// instance from a pool; the functions of an instance check the context of the
+// one execution using it, so ranges calling functions stop at their next call.
+type templateExecutor struct {
+	tmpl      Template // Served by TemplateCache.Get and used without a context
+	master    Template // Never executed, html/template cannot clone executed templates
+	funcMap   template.FuncMap
+	execFuncs executionFuncs
+	pool      sync.Pool
+}
+
+// newTemplateExecutor creates an executor for tmpl, whose functions are funcMap
+// with those of execFuncs bound to each execution. An html/template that was
+// already executed cannot be cloned; it is executed with only its output
+// checked against the context.
+func newTemplateExecutor(tmpl Template, funcMap template.FuncMap, execFuncs executionFuncs) *templateExecutor {
+	e := &templateExecutor{tmpl: tmpl, master: tmpl, funcMap: funcMap, execFuncs: execFuncs}
+	if _, ok := tmpl.(*htmltemplate.Template); ok {
+		clone, err := cloneTemplate(tmpl, nil)
+		if err != nil {
+			e.master = nil
+		} else {
+			e.tmpl = clone
+		}
+	}
+	return e
+}
+
+// instance takes a template instance from the pool or creates one
+func (e *templateExecutor) instance() (*templateInstance, error) {
+	if instance, ok := e.pool.Get().(*templateInstance); ok {
+		return instance, nil
+	}
+
+	state := &executionState{}
+	funcs := make(template.FuncMap, len(e.funcMap))
+	for name, fn := range e.funcMap {
+		if create, ok := e.execFuncs[name]; ok {
+			fn = create(state)
+		}
+		funcs[name] = guardFunc(fn, state)
+	}
+	tmpl, err := cloneTemplate(e.master, funcs)
+	if err != nil {
+		return nil, err
+	}
+	return &templateInstance{tmpl: tmpl, state: state}, nil
+}
+
+// execute runs the template and stops once ctx is cancelled or its deadline
+// passes: function calls and writes fail from that point on. It only returns
+// after the template has stopped executing. limit is the output limit of the
+// execution, which execFuncs such as repeat see (0 = unlimited output).
+func (e *templateExecutor) execute(ctx context.Context, output io.Writer, data interface{}, limit int64) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+
+	// Contexts that can never be cancelled need no supervision, so without an
+	// output limit the compiled template runs as is
+	if ctx.Done() == nil && limit == 0 {
+		return e.tmpl.Execute(output, data)
+	}
+	writer := output
+	if ctx.Done() != nil {
+		writer = &contextWriter{ctx: ctx, w: output}
+	}
+
+	var err error
+	if len(e.funcMap) == 0 || e.master == nil {
+		err = e.tmpl.Execute(writer, data)
+	} else {
+		instance, instanceErr := e.instance()
+		if instanceErr != nil {
+			return instanceErr
+		}
+		instance.state.ctx, instance.state.limit = ctx, limit
+		err = instance.tmpl.Execute(writer, data)
+		instance.state.ctx = nil
+		e.pool.Put(instance)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		return contextError(ctx.Err())
+	}
+	return err
+}
+
+// guardFunc wraps a template function so that it fails with the context error
+// once the context of state is done. text/template reports panics in function
+// calls as execution errors, so the wrapper keeps the function's signature.
+func guardFunc(fn interface{}, state *executionState) interface{} {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fn
+	}
+	return reflect.MakeFunc(v.Type(), func(args []reflect.Value) []reflect.Value {
+		if state.ctx != nil {
+			if err := state.ctx.Err(); err != nil {
+				panic(contextError(err))
+			}
+		}
+		if v.Type().IsVariadic() {
+			return v.CallSlice(args)
+		}
+		return v.Call(args)
+	}).Interface()
+}
+
+// cloneTemplate clones a template of either engine and sets funcs on the clone
+func cloneTemplate(tmpl Template, funcs template.FuncMap) (Template, error) {
+	switch t := tmpl.(type) {
+	case *template.Template:
+		clone, err := t.Clone()
+		if err != nil {
+			return nil, err
+		}
+		return clone.Funcs(funcs), nil
+	case *htmltemplate.Template:
+		clone, err := t.Clone()
+		if err != nil {
+			return nil, err
+		}
+		return clone.Funcs(htmltemplate.FuncMap(funcs)), nil
+	}
+	return nil, fmt.Errorf("cannot clone template of type %T", tmpl)
+}
+
+// contextError maps a context error to the error returned by the parser.
+// Deadlines are reported as ErrExecutionTimeout, cancellations as context.Canceled.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrExecutionTimeout, err)
+	}
+	return fmt.Errorf("template execution cancelled: %w", err)
+}
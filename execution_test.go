@@ -0,0 +1,338 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type contextKey string
+
+func newContextTestParser(t *testing.T) Parser {
+	t.Helper()
+	funcMap := DefaultFuncMap()
+	funcMap["slow"] = func(v interface{}) interface{} {
+		time.Sleep(time.Millisecond)
+		return v
+	}
+	funcMap["ctxValue"] = func(ctx context.Context, key string) interface{} {
+		return ctx.Value(contextKey(key))
+	}
+
+	p, err := NewParser(Config{FuncMap: funcMap})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	return p
+}
+
+// Test execution deadline stops a runaway template
+func TestParseContextDeadline(t *testing.T) {
+	p := newContextTestParser(t)
+	defer p.Close()
+
+	if err := p.UpdateTemplate("runaway", `{{range .Custom}}{{slow .}}{{end}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	start := time.Now()
+	var buf bytes.Buffer
+	_, err := p.ParseWithContext(ctx, "runaway", req, make([]int, 100000), &buf)
+
+	if !errors.Is(err, ErrExecutionTimeout) {
+		t.Fatalf("Expected ErrExecutionTimeout, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error to wrap context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected execution to stop promptly, took %v", elapsed)
+	}
+}
+
+// Test a deadline stops function calls in ranges that write no output
+func TestParseContextStopsFunctions(t *testing.T) {
+	var calls atomic.Int64
+	funcMap := DefaultFuncMap()
+	funcMap["slow"] = func(v interface{}) interface{} {
+		calls.Add(1)
+		time.Sleep(time.Millisecond)
+		return v
+	}
+
+	for _, name := range []string{"runaway", "runaway.html"} {
+		p, err := NewParser(Config{FuncMap: funcMap, HTMLExtensions: []string{".html"}})
+		if err != nil {
+			t.Fatalf("Failed to create parser: %v", err)
+		}
+		defer p.Close()
+
+		if err := p.UpdateTemplate(name, `{{range .Custom}}{{$x := slow .}}{{end}}`); err != nil {
+			t.Fatalf("Failed to update template: %v", err)
+		}
+
+		calls.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		_, err = p.ParseWithContext(ctx, name, req, make([]int, 100000), &bytes.Buffer{})
+		cancel()
+		if !errors.Is(err, ErrExecutionTimeout) {
+			t.Fatalf("Expected ErrExecutionTimeout for %s, got %v", name, err)
+		}
+
+		// No call may happen once ParseWithContext has returned
+		returned := calls.Load()
+		time.Sleep(50 * time.Millisecond)
+		if after := calls.Load(); after != returned {
+			t.Errorf("Expected no calls after return for %s, got %d more", name, after-returned)
+		}
+		if returned == 0 || returned > 1000 {
+			t.Errorf("Expected execution to stop at the deadline for %s, got %d calls", name, returned)
+		}
+
+		// The same template still runs without a deadline
+		var buf bytes.Buffer
+		if _, err := p.ParseWith(name, req, []int{1, 2}, &buf); err != nil {
+			t.Errorf("Failed to parse %s without deadline: %v", name, err)
+		}
+	}
+}
+
+// Test cancelled context aborts before execution
+func TestParseContextCancelled(t *testing.T) {
+	p := newContextTestParser(t)
+	defer p.Close()
+
+	if err := p.UpdateTemplate("simple", `Hello`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	var buf bytes.Buffer
+	_, err := p.ParseContext(ctx, "simple", req, &buf)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if errors.Is(err, ErrExecutionTimeout) {
+		t.Error("Cancellation must not be reported as a timeout")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output, got '%s'", buf.String())
+	}
+}
+
+// Test context values reach template functions
+func TestParseContextValues(t *testing.T) {
+	p := newContextTestParser(t)
+	defer p.Close()
+
+	if err := p.UpdateTemplate("tenant", `tenant={{ctxValue .Context "tenant"}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), contextKey("tenant"), "acme"), time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	var buf bytes.Buffer
+	data, err := p.ParseContext(ctx, "tenant", req, &buf)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "tenant=acme" {
+		t.Errorf("Expected 'tenant=acme', got '%s'", buf.String())
+	}
+	if data.Context != ctx {
+		t.Error("Expected RequestData.Context to be the parse context")
+	}
+}
+
+// Test generic parser with context
+func TestGenericParserContext(t *testing.T) {
+	p, err := NewGenericParser[int](Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("count", `{{len .Query}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/?a=1&b=2", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	result, _, err := p.ParseContext(ctx, "count", req)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if result != 2 {
+		t.Errorf("Expected 2, got %d", result)
+	}
+
+	cancel()
+	if _, _, err := p.ParseWithContext(ctx, "count", req, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// Test output size limit stops execution
+func TestMaxOutputBytes(t *testing.T) {
+	p, err := NewParser(Config{MaxOutputBytes: 100})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("loop", `{{range .Custom}}0123456789{{end}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+
+	var buf bytes.Buffer
+	if _, err := p.ParseWith("loop", req, make([]int, 10), &buf); err != nil {
+		t.Fatalf("Expected output within limit to succeed, got %v", err)
+	}
+
+	buf.Reset()
+	_, err = p.ParseWith("loop", req, make([]int, 1000), &buf)
+	if !errors.Is(err, ErrOutputTooLarge) {
+		t.Fatalf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	if buf.Len() > 100 {
+		t.Errorf("Expected at most 100 bytes of output, got %d", buf.Len())
+	}
+
+	// Per-call override raises the limit
+	buf.Reset()
+	ctx := WithMaxOutputBytes(context.Background(), 20000)
+	if _, err := p.ParseWithContext(ctx, "loop", req, make([]int, 1000), &buf); err != nil {
+		t.Errorf("Expected per-call limit to allow output, got %v", err)
+	}
+}
+
+// Test repeat is capped at the output limit of each execution
+func TestDefaultFuncMapWithLimit(t *testing.T) {
+	p, err := NewParser(Config{MaxOutputBytes: 1000})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("bomb", `{{$x := repeat .Body 100000}}{{len $x}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("xx")))
+	var buf bytes.Buffer
+	if _, err := p.Parse("bomb", req, &buf); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge from repeat, got %v", err)
+	}
+
+	// A per-call limit applies to repeat as well
+	req, _ = http.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("xx")))
+	buf.Reset()
+	ctx := WithMaxOutputBytes(context.Background(), 1<<20)
+	if _, err := p.ParseContext(ctx, "bomb", req, &buf); err != nil || buf.String() != "200000" {
+		t.Errorf("Expected per-call limit to allow repeat, got '%s' (%v)", buf.String(), err)
+	}
+
+	funcMap := DefaultFuncMapWithLimit(3)
+	substr := funcMap["substr"].(func(string, int, int) string)
+	if got := substr("abcdef", 1, 10); got != "bcdef" {
+		t.Errorf("Expected 'bcdef', got '%s'", got)
+	}
+	if got := substr("abcdef", 1, -1); got != "" {
+		t.Errorf("Expected empty string for negative length, got '%s'", got)
+	}
+
+	repeat := funcMap["repeat"].(func(string, int) (string, error))
+	if got, err := repeat("a", 3); err != nil || got != "aaa" {
+		t.Errorf("Expected 'aaa', got '%s' (%v)", got, err)
+	}
+	if _, err := repeat("a", 4); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+}
+
+// Test repeat is capped without an output limit and with a custom function map
+func TestRepeatDefaultLimit(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{$x := repeat .Body 1000000}}{{len $x}}`
+	if err := p.UpdateTemplate("bomb", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("xx")))
+	var buf bytes.Buffer
+	if _, err := p.Parse("bomb", req, &buf); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge above DefaultMaxRepeatBytes, got %v", err)
+	}
+
+	req, _ = http.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("xx")))
+	buf.Reset()
+	ctx := WithMaxOutputBytes(context.Background(), 10)
+	if err := p.UpdateTemplate("small", `{{repeat .Body 6}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if _, err := p.ParseContext(ctx, "small", req, &buf); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge from per-call limit, got %v", err)
+	}
+}
+
+// Test that Config.MaxRepeatBytes caps repeat on its own
+func TestRepeatConfiguredLimit(t *testing.T) {
+	p, err := NewParser(Config{MaxRepeatBytes: 8})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("fits", `{{$x := repeat .Body 4}}{{len $x}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if err := p.UpdateTemplate("large", `{{$x := repeat .Body 5}}{{len $x}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("xx")))
+	var buf bytes.Buffer
+	if _, err := p.Parse("fits", req, &buf); err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if buf.String() != "8" {
+		t.Errorf("Expected 8, got %q", buf.String())
+	}
+
+	req, _ = http.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("xx")))
+	buf.Reset()
+	if _, err := p.Parse("large", req, &buf); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge above MaxRepeatBytes, got %v", err)
+	}
+
+	// A lower output limit of the call applies
+	req, _ = http.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("xx")))
+	buf.Reset()
+	ctx := WithMaxOutputBytes(context.Background(), 6)
+	if _, err := p.ParseContext(ctx, "fits", req, &buf); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge from per-call limit, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is the default interval used by FileSystemLoader to scan for changes
+const DefaultPollInterval = time.Second
+
+// FileSystemLoader loads templates from a directory on disk.
+// Template names are the file paths relative to the root directory, using "/" as
+// separator and without the extension, e.g. "orders/create" for "orders/create.tmpl".
+type FileSystemLoader struct {
+	root         string
+	extension    string
+	recursive    bool
+	pollInterval time.Duration
+	mu           sync.RWMutex
+}
+
+// fileState captures the attributes used to detect file changes
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewFileSystemLoader creates a new file system based template loader.
+// Only files ending with extension are considered (an empty extension matches all files).
+// If recursive is true, templates in subdirectories are loaded as well.
+func NewFileSystemLoader(root, extension string, recursive bool) *FileSystemLoader {
+	return &FileSystemLoader{
+		root:         root,
+		extension:    extension,
+		recursive:    recursive,
+		pollInterval: DefaultPollInterval,
+	}
+}
+
+// SetPollInterval sets how often Watch scans the directory for changes
+func (f *FileSystemLoader) SetPollInterval(interval time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if interval > 0 {
+		f.pollInterval = interval
+	}
+}
+
+// Load implements TemplateLoader
+func (f *FileSystemLoader) Load(name string) (string, error) {
+	path, err := f.pathFor(name)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", ErrTemplateNotFound
+		}
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// List implements TemplateLoader
+func (f *FileSystemLoader) List() ([]string, error) {
+	states, err := f.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// Watch implements TemplateLoader by polling the directory until ctx is done.
+// The callback is invoked with the template name whenever a template is created,
+// modified or deleted.
+func (f *FileSystemLoader) Watch(ctx context.Context, callback func(name string)) error {
+	previous, err := f.scan()
+	if err != nil {
+		return err
+	}
+
+	f.mu.RLock()
+	interval := f.pollInterval
+	f.mu.RUnlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current, err := f.scan()
+				if err != nil {
+					// Keep the previous snapshot and retry on the next tick
+					continue
+				}
+
+				for name, state := range current {
+					if old, exists := previous[name]; !exists || !old.modTime.Equal(state.modTime) || old.size != state.size {
+						callback(name)
+					}
+				}
+				for name := range previous {
+					if _, exists := current[name]; !exists {
+						callback(name)
+					}
+				}
+
+				previous = current
+			}
+		}
+	}()
+
+	return nil
+}
+
+// LastModified implements TemplateLoader
+func (f *FileSystemLoader) LastModified(name string) (time.Time, error) {
+	path, err := f.pathFor(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return time.Time{}, ErrTemplateNotFound
+		}
+		return time.Time{}, err
+	}
+
+	return info.ModTime(), nil
+}
+
+// pathFor maps a template name to its file path, rejecting names outside the root
+func (f *FileSystemLoader) pathFor(name string) (string, error) {
+	if name == "" || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", ErrTemplateNotFound
+	}
+	if !f.recursive && strings.Contains(name, "/") {
+		return "", ErrTemplateNotFound
+	}
+	return filepath.Join(f.root, filepath.FromSlash(name)+f.extension), nil
+}
+
+// scan walks the root directory and returns the state of every matching template
+func (f *FileSystemLoader) scan() (map[string]fileState, error) {
+	states := make(map[string]fileState)
+
+	err := filepath.WalkDir(f.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != f.root && !f.recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(d.Name(), f.extension) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// File vanished between listing and stat
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), f.extension)
+
+		states[name] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
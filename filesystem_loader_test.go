@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func writeTemplateFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write template file: %v", err)
+	}
+}
+
+// Test file system loader
+func TestFileSystemLoader(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFile(t, filepath.Join(dir, "greeting.tmpl"), "Hello {{.Request.Method}}")
+	writeTemplateFile(t, filepath.Join(dir, "orders", "create.tmpl"), "Create order")
+	writeTemplateFile(t, filepath.Join(dir, "notes.txt"), "ignored")
+
+	loader := NewFileSystemLoader(dir, ".tmpl", true)
+
+	content, err := loader.Load("greeting")
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	if content != "Hello {{.Request.Method}}" {
+		t.Errorf("Expected 'Hello {{.Request.Method}}', got '%s'", content)
+	}
+
+	content, err = loader.Load("orders/create")
+	if err != nil {
+		t.Fatalf("Failed to load nested template: %v", err)
+	}
+	if content != "Create order" {
+		t.Errorf("Expected 'Create order', got '%s'", content)
+	}
+
+	names, err := loader.List()
+	if err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "greeting" || names[1] != "orders/create" {
+		t.Errorf("Expected [greeting orders/create], got %v", names)
+	}
+
+	if _, err := loader.Load("notes"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound for filtered extension, got %v", err)
+	}
+	if _, err := loader.Load("../greeting"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound for path outside root, got %v", err)
+	}
+	if _, err := loader.LastModified("missing"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+// Test file system loader without recursion
+func TestFileSystemLoaderNonRecursive(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFile(t, filepath.Join(dir, "top.tmpl"), "top")
+	writeTemplateFile(t, filepath.Join(dir, "sub", "nested.tmpl"), "nested")
+
+	loader := NewFileSystemLoader(dir, ".tmpl", false)
+
+	names, err := loader.List()
+	if err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	if len(names) != 1 || names[0] != "top" {
+		t.Errorf("Expected [top], got %v", names)
+	}
+
+	if _, err := loader.Load("sub/nested"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound for nested template, got %v", err)
+	}
+}
+
+// Test file system loader watching for created, modified and deleted files
+func TestFileSystemLoaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFile(t, filepath.Join(dir, "existing.tmpl"), "v1")
+	writeTemplateFile(t, filepath.Join(dir, "removed.tmpl"), "bye")
+
+	loader := NewFileSystemLoader(dir, ".tmpl", true)
+	loader.SetPollInterval(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan string, 10)
+	if err := loader.Watch(ctx, func(name string) { changes <- name }); err != nil {
+		t.Fatalf("Failed to start watching: %v", err)
+	}
+
+	writeTemplateFile(t, filepath.Join(dir, "existing.tmpl"), "version 2")
+	writeTemplateFile(t, filepath.Join(dir, "sub", "created.tmpl"), "new")
+	if err := os.Remove(filepath.Join(dir, "removed.tmpl")); err != nil {
+		t.Fatalf("Failed to remove template: %v", err)
+	}
+
+	expected := map[string]bool{"existing": false, "sub/created": false, "removed": false}
+	timeout := time.After(2 * time.Second)
+	for remaining := len(expected); remaining > 0; {
+		select {
+		case name := <-changes:
+			if seen, ok := expected[name]; ok && !seen {
+				expected[name] = true
+				remaining--
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for change notifications, got %v", expected)
+		}
+	}
+}
+
+// Test parser reloading templates from the file system
+func TestParserWithFileSystemLoader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "greeting.tmpl")
+	writeTemplateFile(t, path, "Hello {{.Request.Method}}")
+
+	loader := NewFileSystemLoader(dir, ".tmpl", true)
+	p, err := NewParser(Config{TemplateLoader: loader, MaxCacheSize: 10})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+
+	var buf bytes.Buffer
+	if _, err := p.Parse("greeting", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "Hello GET" {
+		t.Errorf("Expected 'Hello GET', got '%s'", buf.String())
+	}
+
+	writeTemplateFile(t, path, "Bye {{.Request.Method}}")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("Failed to update modification time: %v", err)
+	}
+
+	buf.Reset()
+	if _, err := p.Parse("greeting", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "Bye GET" {
+		t.Errorf("Expected 'Bye GET', got '%s'", buf.String())
+	}
+}
@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FSLoader loads templates from any fs.FS, such as an embed.FS or os.DirFS.
+// Template names are the slash-separated file paths without their extension,
+// e.g. "orders/create" for "orders/create.tmpl". The FS is indexed on first use;
+// files added later, e.g. to an os.DirFS, are found after the next List.
+type FSLoader struct {
+	fsys     fs.FS
+	pattern  string
+	loadedAt time.Time
+	index    map[string]string // template name -> file path
+	mu       sync.RWMutex
+}
+
+// NewFSLoader creates a new template loader backed by fsys.
+// pattern filters file base names and is either a glob (e.g. "*.tmpl") or a
+// plain extension (e.g. ".tmpl"). An empty pattern matches every file.
+func NewFSLoader(fsys fs.FS, pattern string) *FSLoader {
+	if strings.HasPrefix(pattern, ".") && !strings.ContainsAny(pattern, `*?[\`) {
+		pattern = "*" + pattern
+	}
+	return &FSLoader{
+		fsys:     fsys,
+		pattern:  pattern,
+		loadedAt: time.Now(),
+	}
+}
+
+// Load implements TemplateLoader
+func (l *FSLoader) Load(name string) (string, error) {
+	filePath, err := l.resolve(name)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := fs.ReadFile(l.fsys, filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", ErrTemplateNotFound
+		}
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// List implements TemplateLoader
+func (l *FSLoader) List() ([]string, error) {
+	index, err := l.reindex()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(index))
+	for name := range index {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// Watch implements TemplateLoader (no-op for fs.FS loader)
+func (l *FSLoader) Watch(ctx context.Context, callback func(name string)) error {
+	// fs.FS offers no change notification; embedded files never change
+	return nil
+}
+
+// LastModified implements TemplateLoader.
+// Files without a modification time (as in embed.FS) report the time the loader
+// was created, so the value stays stable and cached templates are not recompiled.
+func (l *FSLoader) LastModified(name string) (time.Time, error) {
+	filePath, err := l.resolve(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := fs.Stat(l.fsys, filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return time.Time{}, ErrTemplateNotFound
+		}
+		return time.Time{}, err
+	}
+
+	if modTime := info.ModTime(); !modTime.IsZero() {
+		return modTime, nil
+	}
+	return l.loadedAt, nil
+}
+
+// resolve returns the file path for a template name, indexing the FS on first use.
+// Misses do not rescan the FS, since loaders such as OverlayLoader look up
+// templates of other layers on every call
+func (l *FSLoader) resolve(name string) (string, error) {
+	l.mu.RLock()
+	index := l.index
+	l.mu.RUnlock()
+
+	if index == nil {
+		var err error
+		if index, err = l.reindex(); err != nil {
+			return "", err
+		}
+	}
+
+	filePath, exists := index[name]
+	if !exists {
+		return "", ErrTemplateNotFound
+	}
+	return filePath, nil
+}
+
+// reindex walks the FS and rebuilds the name to path index
+func (l *FSLoader) reindex() (map[string]string, error) {
+	index := make(map[string]string)
+
+	err := fs.WalkDir(l.fsys, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if l.pattern != "" {
+			matched, err := path.Match(l.pattern, d.Name())
+			if err != nil {
+				return err
+			}
+			if !matched {
+				return nil
+			}
+		}
+
+		name := strings.TrimSuffix(filePath, path.Ext(filePath))
+		index[name] = filePath
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.index = index
+	l.mu.Unlock()
+
+	return index, nil
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"io/fs"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// Test fs.FS loader
+func TestFSLoader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"greeting.tmpl":      {Data: []byte("Hello {{.Request.Method}}")},
+		"orders/create.tmpl": {Data: []byte("Create order")},
+		"README.md":          {Data: []byte("ignored")},
+	}
+
+	loader := NewFSLoader(fsys, ".tmpl")
+
+	content, err := loader.Load("orders/create")
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	if content != "Create order" {
+		t.Errorf("Expected 'Create order', got '%s'", content)
+	}
+
+	names, err := loader.List()
+	if err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "greeting" || names[1] != "orders/create" {
+		t.Errorf("Expected [greeting orders/create], got %v", names)
+	}
+
+	if _, err := loader.Load("README"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound for filtered file, got %v", err)
+	}
+}
+
+// walkCountingFS counts the walks of its root directory
+type walkCountingFS struct {
+	fs.FS
+	walks int
+}
+
+// ReadDir implements fs.ReadDirFS
+func (f *walkCountingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == "." {
+		f.walks++
+	}
+	return fs.ReadDir(f.FS, name)
+}
+
+// Test fs.FS loader indexes the FS once instead of on every miss
+func TestFSLoaderIndexOnce(t *testing.T) {
+	files := fstest.MapFS{"a.tmpl": {Data: []byte("a")}}
+	fsys := &walkCountingFS{FS: files}
+	loader := NewFSLoader(fsys, ".tmpl")
+
+	for i := 0; i < 3; i++ {
+		if _, err := loader.Load("a"); err != nil {
+			t.Fatalf("Failed to load template: %v", err)
+		}
+		if _, err := loader.LastModified("missing"); err != ErrTemplateNotFound {
+			t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+		}
+	}
+	if fsys.walks != 1 {
+		t.Errorf("Expected 1 walk, got %d", fsys.walks)
+	}
+
+	// Files added later are found once the templates are listed again
+	files["b.tmpl"] = &fstest.MapFile{Data: []byte("b")}
+	if _, err := loader.Load("b"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound before List, got %v", err)
+	}
+	if _, err := loader.List(); err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	if content, err := loader.Load("b"); err != nil || content != "b" {
+		t.Errorf("Expected 'b', got %q (%v)", content, err)
+	}
+}
+
+// Test fs.FS loader with glob pattern
+func TestFSLoaderGlobPattern(t *testing.T) {
+	fsys := fstest.MapFS{
+		"mail_welcome.html": {Data: []byte("welcome")},
+		"mail_reset.html":   {Data: []byte("reset")},
+		"page.html":         {Data: []byte("page")},
+	}
+
+	loader := NewFSLoader(fsys, "mail_*.html")
+
+	names, err := loader.List()
+	if err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "mail_reset" || names[1] != "mail_welcome" {
+		t.Errorf("Expected [mail_reset mail_welcome], got %v", names)
+	}
+}
+
+// Test fs.FS loader reports a stable modification time
+func TestFSLoaderLastModified(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"embedded.tmpl": {Data: []byte("embedded")},
+		"dated.tmpl":    {Data: []byte("dated"), ModTime: modTime},
+	}
+
+	loader := NewFSLoader(fsys, ".tmpl")
+
+	first, err := loader.LastModified("embedded")
+	if err != nil {
+		t.Fatalf("Failed to get last modified time: %v", err)
+	}
+	second, _ := loader.LastModified("embedded")
+	if first.IsZero() || !first.Equal(second) {
+		t.Errorf("Expected stable non-zero modification time, got %v and %v", first, second)
+	}
+
+	dated, err := loader.LastModified("dated")
+	if err != nil {
+		t.Fatalf("Failed to get last modified time: %v", err)
+	}
+	if !dated.Equal(modTime) {
+		t.Errorf("Expected %v, got %v", modTime, dated)
+	}
+
+	if _, err := loader.LastModified("missing"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+
+	// Cached templates must not be recompiled when nothing changed
+	cache := NewTemplateCache(10, nil)
+	tmpl1, err := cache.Get("embedded", loader)
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+	tmpl2, err := cache.Get("embedded", loader)
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+	if tmpl1 != tmpl2 {
+		t.Error("Expected cached template to be reused")
+	}
+}
@@ -1,3 +1,11 @@
 module github.com/fabricates/parser
 
 go 1.22
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/andybalholm/brotli v1.2.0
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/text v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
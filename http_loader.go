@@ -0,0 +1,383 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for HTTPLoader requests
+const (
+	// DefaultHTTPTimeout bounds each request to the remote, including reading the body
+	DefaultHTTPTimeout = 10 * time.Second
+
+	// DefaultMaxTemplateSize is the largest remote template accepted, in bytes
+	DefaultMaxTemplateSize = 1 << 20
+)
+
+// HTTPLoader fetches templates by name from a remote base URL.
+// Requests are revalidated with ETag/If-Modified-Since, and fetched templates are
+// optionally persisted to a local directory so they stay available when the remote is down.
+type HTTPLoader struct {
+	baseURL      string
+	cacheDir     string
+	client       *http.Client
+	pollInterval time.Duration
+	maxSize      int64
+	entries      map[string]*remoteTemplate
+	mu           sync.Mutex
+}
+
+// remoteTemplate is the locally known state of a remote template
+type remoteTemplate struct {
+	Content      string    `json:"content"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	checkedAt    time.Time
+}
+
+// NewHTTPLoader creates a loader that fetches templates from baseURL + "/" + name.
+// If cacheDir is not empty, fetched templates are stored there as a fallback.
+func NewHTTPLoader(baseURL, cacheDir string) *HTTPLoader {
+	return &HTTPLoader{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		cacheDir:     cacheDir,
+		client:       &http.Client{Timeout: DefaultHTTPTimeout},
+		pollInterval: DefaultPollInterval,
+		maxSize:      DefaultMaxTemplateSize,
+		entries:      make(map[string]*remoteTemplate),
+	}
+}
+
+// SetHTTPClient sets the client used for requests to the remote
+func (h *HTTPLoader) SetHTTPClient(client *http.Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client != nil {
+		h.client = client
+	}
+}
+
+// SetTimeout sets the timeout of requests to the remote (default DefaultHTTPTimeout).
+// The client set with SetHTTPClient is copied, not modified.
+func (h *HTTPLoader) SetTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if timeout > 0 {
+		client := *h.client
+		client.Timeout = timeout
+		h.client = &client
+	}
+}
+
+// SetMaxTemplateSize sets the largest remote template accepted, in bytes
+// (default DefaultMaxTemplateSize)
+func (h *HTTPLoader) SetMaxTemplateSize(size int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if size > 0 {
+		h.maxSize = size
+	}
+}
+
+// SetPollInterval sets how often templates are revalidated against the remote
+func (h *HTTPLoader) SetPollInterval(interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if interval > 0 {
+		h.pollInterval = interval
+	}
+}
+
+// Load implements TemplateLoader
+func (h *HTTPLoader) Load(name string) (string, error) {
+	entry, err := h.get(name, false)
+	if err != nil {
+		return "", err
+	}
+	return entry.Content, nil
+}
+
+// List implements TemplateLoader.
+// The remote has no listing endpoint, so this returns the templates known locally:
+// those fetched so far and those present in the cache directory.
+func (h *HTTPLoader) List() ([]string, error) {
+	h.mu.Lock()
+	known := make(map[string]struct{}, len(h.entries))
+	for name := range h.entries {
+		known[name] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	if h.cacheDir != "" {
+		files, err := os.ReadDir(h.cacheDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+				continue
+			}
+			if name, err := url.PathUnescape(strings.TrimSuffix(file.Name(), ".json")); err == nil {
+				known[name] = struct{}{}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(known))
+	for name := range known {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Watch implements TemplateLoader by revalidating every known template each poll
+// interval. The callback is only invoked for templates whose ETag changed or that
+// were removed from the remote.
+func (h *HTTPLoader) Watch(ctx context.Context, callback func(name string)) error {
+	h.mu.Lock()
+	interval := h.pollInterval
+	h.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.mu.Lock()
+				previous := make(map[string]string, len(h.entries))
+				for name, entry := range h.entries {
+					previous[name] = entry.ETag
+				}
+				h.mu.Unlock()
+
+				for name, etag := range previous {
+					entry, err := h.get(name, true)
+					if errors.Is(err, ErrTemplateNotFound) {
+						callback(name)
+						continue
+					}
+					if err != nil {
+						continue
+					}
+					if entry.ETag != etag {
+						callback(name)
+					}
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// LastModified implements TemplateLoader.
+// The remote is revalidated at most once per poll interval with a conditional request.
+func (h *HTTPLoader) LastModified(name string) (time.Time, error) {
+	entry, err := h.get(name, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return entry.LastModified, nil
+}
+
+// get returns the current state of a template, revalidating it with the remote
+// when it is unknown, stale or force is set
+func (h *HTTPLoader) get(name string, force bool) (remoteTemplate, error) {
+	h.mu.Lock()
+	entry, exists := h.entries[name]
+	if exists && !force && time.Since(entry.checkedAt) < h.pollInterval {
+		result := *entry
+		h.mu.Unlock()
+		return result, nil
+	}
+	if exists {
+		// Work on a copy, the stored entry is only replaced under the lock
+		copied := *entry
+		entry = &copied
+	}
+	client, maxSize := h.client, h.maxSize
+	h.mu.Unlock()
+
+	if !exists {
+		// Seed from the disk cache so the conditional request can avoid a full download
+		if cached, err := h.readCache(name); err == nil {
+			entry = cached
+		}
+	}
+
+	fetched, err := h.fetch(client, maxSize, name, entry)
+	if err != nil {
+		if errors.Is(err, ErrTemplateNotFound) {
+			h.mu.Lock()
+			delete(h.entries, name)
+			h.mu.Unlock()
+			h.removeCache(name)
+			return remoteTemplate{}, err
+		}
+		if entry == nil {
+			return remoteTemplate{}, err
+		}
+		// Remote unavailable, keep serving the last known content
+		fetched = entry
+	}
+
+	fetched.checkedAt = time.Now()
+
+	h.mu.Lock()
+	h.entries[name] = fetched
+	result := *fetched
+	h.mu.Unlock()
+
+	return result, nil
+}
+
+// fetch performs a (conditional) GET for a template
+func (h *HTTPLoader) fetch(client *http.Client, maxSize int64, name string, known *remoteTemplate) (*remoteTemplate, error) {
+	target, err := h.urlFor(name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if known != nil {
+		if known.ETag != "" {
+			req.Header.Set("If-None-Match", known.ETag)
+		}
+		if !known.LastModified.IsZero() {
+			req.Header.Set("If-Modified-Since", known.LastModified.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && known != nil:
+		updated := *known
+		return &updated, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrTemplateNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("fetching template %q: unexpected status %s", name, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("fetching template %q: %w (limit %d bytes)", name, ErrTemplateTooLarge, maxSize)
+	}
+
+	fetched := &remoteTemplate{
+		Content: string(body),
+		ETag:    resp.Header.Get("ETag"),
+	}
+	if lastMod, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		fetched.LastModified = lastMod
+	} else if known != nil && known.Content == fetched.Content {
+		fetched.LastModified = known.LastModified
+	} else {
+		fetched.LastModified = time.Now()
+	}
+
+	if err := h.writeCache(name, fetched); err != nil {
+		slog.Warn("Failed to cache remote template", "name", name, "error", err)
+	}
+	return fetched, nil
+}
+
+// urlFor builds the remote URL of a template, escaping each path segment.
+// Names with ".." segments are rejected so they cannot leave the base URL.
+func (h *HTTPLoader) urlFor(name string) (string, error) {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		if segment == ".." {
+			return "", fmt.Errorf("invalid template name %q", name)
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	return h.baseURL + "/" + strings.Join(segments, "/"), nil
+}
+
+// cachePath returns the disk cache file of a template
+func (h *HTTPLoader) cachePath(name string) string {
+	return filepath.Join(h.cacheDir, url.PathEscape(name)+".json")
+}
+
+// readCache loads a template from the disk cache
+func (h *HTTPLoader) readCache(name string) (*remoteTemplate, error) {
+	if h.cacheDir == "" {
+		return nil, ErrTemplateNotFound
+	}
+
+	data, err := os.ReadFile(h.cachePath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	var cached remoteTemplate
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+	return &cached, nil
+}
+
+// writeCache stores a template in the disk cache, replacing the file atomically
+func (h *HTTPLoader) writeCache(name string, entry *remoteTemplate) error {
+	if h.cacheDir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(h.cacheDir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(h.cacheDir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), h.cachePath(name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// removeCache deletes a template from the disk cache
+func (h *HTTPLoader) removeCache(name string) {
+	if h.cacheDir != "" {
+		os.Remove(h.cachePath(name))
+	}
+}
@@ -0,0 +1,221 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// remoteTemplates is a minimal template service used to test HTTPLoader
+type remoteTemplates struct {
+	mu          sync.Mutex
+	templates   map[string]string
+	versions    map[string]int
+	requests    atomic.Int32
+	conditional atomic.Int32
+}
+
+func newRemoteTemplates() *remoteTemplates {
+	return &remoteTemplates{templates: make(map[string]string), versions: make(map[string]int)}
+}
+
+func (r *remoteTemplates) set(name, content string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.templates[name] = content
+	r.versions[name]++
+}
+
+func (r *remoteTemplates) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := req.URL.Path[1:]
+	content, exists := r.templates[name]
+	if !exists {
+		http.NotFound(w, req)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, name, r.versions[name])
+	if req.Header.Get("If-None-Match") == etag {
+		r.conditional.Add(1)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	fmt.Fprint(w, content)
+}
+
+// Test HTTP loader fetching and revalidation
+func TestHTTPLoader(t *testing.T) {
+	remote := newRemoteTemplates()
+	remote.set("orders/create", "Create {{.Body}}")
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	loader := NewHTTPLoader(server.URL, t.TempDir())
+	loader.SetPollInterval(time.Hour)
+
+	content, err := loader.Load("orders/create")
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	if content != "Create {{.Body}}" {
+		t.Errorf("Expected 'Create {{.Body}}', got '%s'", content)
+	}
+
+	// Within the poll interval LastModified must not hit the remote
+	if _, err := loader.LastModified("orders/create"); err != nil {
+		t.Fatalf("Failed to get last modified time: %v", err)
+	}
+	if got := remote.requests.Load(); got != 1 {
+		t.Errorf("Expected 1 remote request, got %d", got)
+	}
+
+	if _, err := loader.Load("missing"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+// Test HTTP loader serves the disk cache when the remote is down
+func TestHTTPLoaderOfflineFallback(t *testing.T) {
+	cacheDir := t.TempDir()
+	remote := newRemoteTemplates()
+	remote.set("greeting", "Hello")
+	server := httptest.NewServer(remote)
+
+	if _, err := NewHTTPLoader(server.URL, cacheDir).Load("greeting"); err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	server.Close()
+
+	loader := NewHTTPLoader(server.URL, cacheDir)
+	content, err := loader.Load("greeting")
+	if err != nil {
+		t.Fatalf("Expected cached template while remote is down, got error: %v", err)
+	}
+	if content != "Hello" {
+		t.Errorf("Expected 'Hello', got '%s'", content)
+	}
+
+	names, err := loader.List()
+	if err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	if len(names) != 1 || names[0] != "greeting" {
+		t.Errorf("Expected [greeting], got %v", names)
+	}
+}
+
+// Test HTTP loader watch only reports templates whose ETag changed
+func TestHTTPLoaderWatch(t *testing.T) {
+	remote := newRemoteTemplates()
+	remote.set("stable", "same")
+	remote.set("changing", "v1")
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	loader := NewHTTPLoader(server.URL, "")
+	loader.SetPollInterval(10 * time.Millisecond)
+	for _, name := range []string{"stable", "changing"} {
+		if _, err := loader.Load(name); err != nil {
+			t.Fatalf("Failed to load template: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan string, 10)
+	if err := loader.Watch(ctx, func(name string) { changes <- name }); err != nil {
+		t.Fatalf("Failed to start watching: %v", err)
+	}
+
+	remote.set("changing", "v2")
+
+	select {
+	case name := <-changes:
+		if name != "changing" {
+			t.Errorf("Expected change for 'changing', got '%s'", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for change notification")
+	}
+
+	content, err := loader.Load("changing")
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	if content != "v2" {
+		t.Errorf("Expected 'v2', got '%s'", content)
+	}
+
+	// Each poll checks every template before the next starts, so once the second of
+	// two further changes is reported, a complete poll has run: the stable template
+	// must not have been reported before it
+	for _, version := range []string{"v3", "v4"} {
+		remote.set("changing", version)
+		select {
+		case name := <-changes:
+			if name != "changing" {
+				t.Errorf("Unexpected change notification for '%s'", name)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for change notification")
+		}
+	}
+
+	if remote.conditional.Load() == 0 {
+		t.Error("Expected conditional requests to be answered with 304")
+	}
+}
+
+// Test HTTP loader limits, timeouts and template names
+func TestHTTPLoaderLimits(t *testing.T) {
+	remote := newRemoteTemplates()
+	remote.set("small", "12345")
+	remote.set("large", strings.Repeat("x", 100))
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	loader := NewHTTPLoader(server.URL, "")
+	loader.SetMaxTemplateSize(10)
+	if content, err := loader.Load("small"); err != nil || content != "12345" {
+		t.Errorf("Expected '12345', got '%s' (%v)", content, err)
+	}
+	if _, err := loader.Load("large"); !errors.Is(err, ErrTemplateTooLarge) {
+		t.Errorf("Expected ErrTemplateTooLarge, got %v", err)
+	}
+
+	for _, name := range []string{"..", "../secret", "a/../../secret"} {
+		if _, err := loader.Load(name); err == nil {
+			t.Errorf("Expected error for template name %q", name)
+		}
+	}
+	if got := remote.requests.Load(); got != 2 {
+		t.Errorf("Expected 2 remote requests, got %d", got)
+	}
+
+	// A hanging remote fails after the timeout
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	defer close(release)
+
+	loader = NewHTTPLoader(hanging.URL, "")
+	loader.SetTimeout(50 * time.Millisecond)
+	if _, err := loader.Load("slow"); err == nil {
+		t.Error("Expected timeout error from hanging remote")
+	}
+}
@@ -0,0 +1,253 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// DefaultMaxRecordBytes is the size limit of one line read by ParseRecords
+const DefaultMaxRecordBytes = 1 << 20 // 1 MB
+
+// ndjsonMediaTypes are the media types decoded as newline-delimited JSON by default
+var ndjsonMediaTypes = []string{
+	"application/x-ndjson",
+	"application/ndjson",
+	"application/jsonl",
+	"application/x-jsonlines",
+	"application/jsonlines",
+}
+
+// RecordError reports a record of a line-delimited body that could not be
+// decoded or executed
+type RecordError struct {
+	// Line is the 1-based line number of the record in the body
+	Line int
+
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements error
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON encodes the error message, since error values do not serialize
+func (e *RecordError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Line int
+		Err  string
+	}{e.Line, e.Err.Error()})
+}
+
+// UnmarshalJSON restores a serialized record error with its message
+func (e *RecordError) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Line int
+		Err  string
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	e.Line, e.Err = v.Line, errors.New(v.Err)
+	return nil
+}
+
+// RecordErrors is a list of record errors. Processing continues past malformed
+// records, so a batch reports all of them at once.
+type RecordErrors []*RecordError
+
+// Error implements error
+func (e RecordErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d malformed records: %s", len(e), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the individual record errors
+func (e RecordErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// NDJSONDecoder is the built-in decoder for newline-delimited JSON (JSON Lines).
+// Each non-blank line is decoded as one JSON value. Malformed lines are skipped
+// and returned as RecordErrors together with the records that were decoded.
+// The records are also exposed as RequestData.BodyRecords.
+type NDJSONDecoder struct {
+	// UseNumber decodes numbers as json.Number instead of float64
+	UseNumber bool
+}
+
+// Decode implements BodyDecoder. The value is a []interface{} of records
+func (d NDJSONDecoder) Decode(body []byte, contentType string) (interface{}, error) {
+	records, err := d.decodeRecords(body)
+	return records, err
+}
+
+// decodeRecords decodes each line of body into a record
+func (d NDJSONDecoder) decodeRecords(body []byte) ([]interface{}, error) {
+	var records []interface{}
+	errs, err := d.scanRecords(bytes.NewReader(body), len(body)+1, func(record interface{}, line int) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return records, err
+	}
+
+	if len(errs) > 0 {
+		return records, errs
+	}
+	return records, nil
+}
+
+// scanRecords reads r line by line and calls fn with each decoded record and
+// its line number. Malformed lines are skipped and returned as RecordErrors;
+// lines longer than maxLine bytes and errors from fn stop the scan.
+func (d NDJSONDecoder) scanRecords(r io.Reader, maxLine int, fn func(record interface{}, line int) error) (RecordErrors, error) {
+	var errs RecordErrors
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+	jsonDecoder := JSONDecoder{UseNumber: d.UseNumber}
+	line := 1
+	for ; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		value, err := jsonDecoder.Decode(text, "")
+		if err != nil {
+			errs = append(errs, &RecordError{Line: line, Err: err})
+			continue
+		}
+		if err := fn(value, line); err != nil {
+			return errs, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("%w: line %d exceeds %d bytes", ErrBodyTooLarge, line, maxLine)
+		}
+		return errs, err
+	}
+
+	return errs, nil
+}
+
+// newRecordStream returns the body of r for reading records one line at a time.
+// The body is decompressed and transcoded to UTF-8 as it is read, and the size
+// limits of options apply to the stream instead of a buffered copy.
+func newRecordStream(r *http.Request, options ExtractOptions) (io.ReadCloser, error) {
+	if r.Body == nil {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	// Bodies that would be spilled to disk are limited like spilled bodies
+	stream := &recordStream{Reader: r.Body}
+	if limit := options.MaxBodyBytes; limit > 0 {
+		if options.SpillBodyToDisk {
+			if limit = options.MaxSpillBytes; limit <= 0 {
+				limit = DefaultMaxSpillBytes
+			}
+		}
+		stream.Reader = newMaxBytesReader(stream.Reader, limit, "body")
+	}
+
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && !options.DisableDecompression {
+		maxDecoded := options.MaxDecodedBodyBytes
+		if maxDecoded <= 0 {
+			maxDecoded = DefaultMaxDecodedBodyBytes
+		}
+		decoded, closers, err := newContentDecodingReader(stream.Reader, encoding)
+		if err != nil {
+			return nil, err
+		}
+		stream.Reader = newMaxBytesReader(decoded, maxDecoded, "decompressed body")
+		stream.closers = closers
+	}
+
+	// NDJSON is UTF-8 by definition, so an unknown charset is read as UTF-8
+	var enc encoding.Encoding = unicode.UTF8
+	if label := charsetFromContentType(r.Header.Get("Content-Type")); label != "" {
+		if labeled, err := lookupCharset(label); err == nil {
+			enc = labeled
+		} else {
+			slog.Warn("Failed to decode body charset", "error", err, "content_type", r.Header.Get("Content-Type"))
+		}
+	}
+	stream.Reader = transform.NewReader(stream.Reader, unicode.BOMOverride(enc.NewDecoder()))
+
+	return stream, nil
+}
+
+// recordStream is a request body reader that releases its decompressors on Close
+type recordStream struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close implements io.Closer
+func (s *recordStream) Close() error {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i].Close()
+	}
+	return nil
+}
+
+// maxBytesReader fails with ErrBodyTooLarge once more than limit bytes are read
+type maxBytesReader struct {
+	r     io.Reader
+	read  int64
+	limit int64
+	what  string
+}
+
+// newMaxBytesReader limits r to limit bytes; what names the data in errors
+func newMaxBytesReader(r io.Reader, limit int64, what string) *maxBytesReader {
+	return &maxBytesReader{r: io.LimitReader(r, limit+1), limit: limit, what: what}
+}
+
+// Read implements io.Reader
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.read += int64(n)
+	if m.read > m.limit {
+		return n - int(m.read-m.limit), fmt.Errorf("%w: %s exceeds %d bytes", ErrBodyTooLarge, m.what, m.limit)
+	}
+	return n, err
+}
+
+// isNDJSONContentType reports whether contentType is a newline-delimited JSON media type
+func isNDJSONContentType(contentType string) bool {
+	mt := mediaType(contentType)
+	for _, ct := range ndjsonMediaTypes {
+		if mt == ct {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const ndjsonBody = `{"level":"info","msg":"started"}
+{"level":"warn","msg":"slow"
+
+{"level":"error","msg":"failed"}
+not json
+`
+
+// Test NDJSON bodies are decoded into records with malformed lines reported
+func TestExtractNDJSON(t *testing.T) {
+	data := extractRequest(t, Config{}, newBodyRequest("application/x-ndjson", ndjsonBody))
+
+	if len(data.BodyRecords) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %v", len(data.BodyRecords), data.BodyRecords)
+	}
+	if record, ok := data.BodyRecords[1].(map[string]interface{}); !ok || record["msg"] != "failed" {
+		t.Errorf("Expected second record to be 'failed', got %v", data.BodyRecords[1])
+	}
+	if records, ok := data.Parsed.([]interface{}); !ok || len(records) != 2 {
+		t.Errorf("Expected Parsed to hold the records, got %v", data.Parsed)
+	}
+
+	if len(data.RecordErrors) != 2 || data.RecordErrors[0].Line != 2 || data.RecordErrors[1].Line != 5 {
+		t.Errorf("Expected errors on lines 2 and 5, got %v", data.RecordErrors)
+	}
+
+	// JSON Lines media types are recognised too
+	if data := extractRequest(t, Config{}, newBodyRequest("application/jsonl", "1\n2\n")); len(data.BodyRecords) != 2 || data.RecordErrors != nil {
+		t.Errorf("Expected 2 records without errors, got %v %v", data.BodyRecords, data.RecordErrors)
+	}
+}
+
+// Test templates run once per record and malformed records do not abort the batch
+func TestParseRecords(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("log", `{{.RecordLine}} {{.Record.level | upper}}: {{.Record.msg}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/ingest", strings.NewReader(ndjsonBody))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	var buf bytes.Buffer
+	data, err := p.ParseRecords("log", req, &buf)
+
+	expected := "1 INFO: started\n4 ERROR: failed\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+	// The body is streamed, so the request data holds no records
+	if data == nil || data.Path != "/ingest" || data.BodyRecords != nil {
+		t.Errorf("Expected request data without records, got %v", data)
+	}
+
+	var recordErrs RecordErrors
+	if !errors.As(err, &recordErrs) || len(recordErrs) != 2 {
+		t.Fatalf("Expected 2 record errors, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), "line 5") {
+		t.Errorf("Expected line numbers in error, got %v", err)
+	}
+}
+
+// Test execution failures are reported per record
+func TestParseRecordsExecutionErrors(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("sum", `{{add .Record.a .Record.b}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	body := "{\"a\":1,\"b\":2}\n{\"a\":\"x\",\"b\":2}\n{\"a\":3,\"b\":4}\n"
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	var buf bytes.Buffer
+	_, err = p.ParseRecords("sum", req, &buf)
+	if buf.String() != "3\n7\n" {
+		t.Errorf("Expected '3\\n7\\n', got %q", buf.String())
+	}
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) || recordErr.Line != 2 {
+		t.Errorf("Expected execution error on line 2, got %v", err)
+	}
+
+	// The output limit applies to the whole stream and aborts it
+	limited, err := NewParser(Config{MaxOutputBytes: 3})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer limited.Close()
+	if err := limited.UpdateTemplate("sum", `{{add .Record.a .Record.b}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader("{\"a\":1,\"b\":2}\n{\"a\":3,\"b\":4}\n"))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	buf.Reset()
+	if _, err := limited.ParseRecords("sum", req, &buf); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+}
+
+// Test ParseRecords rejects bodies that are not NDJSON
+func TestParseRecordsContentType(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+	if err := p.UpdateTemplate("row", `{{.Record}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	for _, contentType := range []string{"text/csv", "application/json", ""} {
+		req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("1\n2\n"))
+		req.Header.Set("Content-Type", contentType)
+		var buf bytes.Buffer
+		_, err := p.ParseRecords("row", req, &buf)
+		if !errors.Is(err, ErrUnsupportedContentType) || !strings.Contains(err.Error(), "not NDJSON") {
+			t.Errorf("Expected not NDJSON error for %q, got %v", contentType, err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("Expected no output for %q, got %q", contentType, buf.String())
+		}
+	}
+}
+
+// notifyWriter signals every write on a channel
+type notifyWriter struct {
+	writes chan string
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	w.writes <- string(p)
+	return len(p), nil
+}
+
+// Test records are rendered as they are read from the body
+func TestParseRecordsStreaming(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+	if err := p.UpdateTemplate("n", `{{.Record.n}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	body, pw := io.Pipe()
+	req, _ := http.NewRequest("POST", "http://example.com/", body)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	output := &notifyWriter{writes: make(chan string)}
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.ParseRecords("n", req, output)
+		done <- err
+	}()
+
+	// Each record is written before the next line is sent
+	for _, n := range []string{"1", "2"} {
+		if _, err := io.WriteString(pw, `{"n":`+n+"}\n"); err != nil {
+			t.Fatalf("Failed to write record: %v", err)
+		}
+		if got := <-output.writes; got != n+"\n" {
+			t.Errorf("Expected %q, got %q", n+"\n", got)
+		}
+	}
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	// Compressed bodies are decoded while streaming
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("{\"n\":3}\n{\"n\":4}\n"))
+	gz.Close()
+	req, _ = http.NewRequest("POST", "http://example.com/", &compressed)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	var buf bytes.Buffer
+	if _, err := p.ParseRecords("n", req, &buf); err != nil || buf.String() != "3\n4\n" {
+		t.Errorf("Expected '3\\n4\\n', got %q (%v)", buf.String(), err)
+	}
+
+	// Lines longer than the record limit fail the stream
+	long := `{"n":"` + strings.Repeat("x", DefaultMaxRecordBytes) + `"}`
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader(long))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if _, err := p.ParseRecords("n", req, io.Discard); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Expected ErrBodyTooLarge for long line, got %v", err)
+	}
+}
+
+// Test streamed bodies that would be spilled to disk are capped at MaxSpillBytes
+func TestParseRecordsSpillLimit(t *testing.T) {
+	p, err := NewParser(Config{MaxBodyBytes: 10, SpillBodyToDisk: true, MaxSpillBytes: 20})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+	if err := p.UpdateTemplate("n", `{{.Record.n}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("{\"n\":1}\n{\"n\":2}\n"))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	var buf bytes.Buffer
+	if _, err := p.ParseRecords("n", req, &buf); err != nil || buf.String() != "1\n2\n" {
+		t.Errorf("Expected '1\\n2\\n', got %q (%v)", buf.String(), err)
+	}
+
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader(strings.Repeat("{\"n\":1}\n", 100)))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if _, err := p.ParseRecords("n", req, io.Discard); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Expected ErrBodyTooLarge above MaxSpillBytes, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// divisionPrecision is the number of decimal places kept when a quotient has no
+// finite decimal representation
+const divisionPrecision = 16
+
+// toRat converts a template value to an exact rational number. It accepts
+// json.Number, strings, and all integer and float kinds
+func toRat(value interface{}) (*big.Rat, error) {
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = strings.TrimSpace(v)
+	case float32:
+		s = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return new(big.Rat).SetInt64(rv.Int()), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return new(big.Rat).SetInt(new(big.Int).SetUint64(rv.Uint())), nil
+		}
+		return nil, fmt.Errorf("not a number: %v (%T)", value, value)
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("not a number: %q", s)
+	}
+	return r, nil
+}
+
+// ratToNumber formats r as a json.Number, using integer notation when possible
+func ratToNumber(r *big.Rat) json.Number {
+	if r.IsInt() {
+		return json.Number(r.Num().String())
+	}
+	if prec, exact := r.FloatPrec(); exact {
+		return json.Number(r.FloatString(prec))
+	}
+	return json.Number(strings.TrimRight(strings.TrimRight(r.FloatString(divisionPrecision), "0"), "."))
+}
+
+// numberOp returns a template function applying op to two numbers exactly
+func numberOp(op func(z, x, y *big.Rat) (*big.Rat, error)) func(a, b interface{}) (json.Number, error) {
+	return func(a, b interface{}) (json.Number, error) {
+		x, err := toRat(a)
+		if err != nil {
+			return "", err
+		}
+		y, err := toRat(b)
+		if err != nil {
+			return "", err
+		}
+		z, err := op(new(big.Rat), x, y)
+		if err != nil {
+			return "", err
+		}
+		return ratToNumber(z), nil
+	}
+}
+
+var (
+	numberAdd = numberOp(func(z, x, y *big.Rat) (*big.Rat, error) {
+		return z.Add(x, y), nil
+	})
+	numberSub = numberOp(func(z, x, y *big.Rat) (*big.Rat, error) {
+		return z.Sub(x, y), nil
+	})
+	numberMul = numberOp(func(z, x, y *big.Rat) (*big.Rat, error) {
+		return z.Mul(x, y), nil
+	})
+	numberDiv = numberOp(func(z, x, y *big.Rat) (*big.Rat, error) {
+		if y.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return z.Quo(x, y), nil
+	})
+	numberMod = numberOp(func(z, x, y *big.Rat) (*big.Rat, error) {
+		if !x.IsInt() || !y.IsInt() {
+			return nil, errors.New("mod requires integers")
+		}
+		if y.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return z.SetInt(new(big.Int).Rem(x.Num(), y.Num())), nil
+	})
+)
+
+// formatNumber formats a number with a fixed number of decimals, rounding
+// halves away from zero
+func formatNumber(decimals int, value interface{}) (string, error) {
+	r, err := toRat(value)
+	if err != nil {
+		return "", err
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	return r.FloatString(decimals), nil
+}
+
+// toInt converts a number to int64, failing if it is fractional or out of range
+func toInt(value interface{}) (int64, error) {
+	r, err := toRat(value)
+	if err != nil {
+		return 0, err
+	}
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return 0, fmt.Errorf("not an int64: %s", r.RatString())
+	}
+	return r.Num().Int64(), nil
+}
+
+// toFloat converts a number to the nearest float64
+func toFloat(value interface{}) (float64, error) {
+	r, err := toRat(value)
+	if err != nil {
+		return 0, err
+	}
+	f, _ := r.Float64()
+	return f, nil
+}
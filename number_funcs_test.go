@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Test JSON numbers keep their precision with UseJSONNumber
+func TestParseJSONNumberPrecision(t *testing.T) {
+	p, err := NewParser(Config{UseJSONNumber: true})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{.BodyJSON.id}} {{add .BodyJSON.id 1}} {{mul .BodyJSON.amount 3}} {{formatNumber 2 (div .BodyJSON.amount 3)}} {{.BodyJSON.big}}`
+	if err := p.UpdateTemplate("numbers", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	body := `{"id":9007199254740993,"amount":19.99,"big":1000000}`
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	var buf bytes.Buffer
+	data, err := p.Parse("numbers", req, &buf)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	expected := "9007199254740993 9007199254740994 59.97 6.66 1000000"
+	if buf.String() != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, buf.String())
+	}
+	if _, ok := data.BodyJSON["id"].(json.Number); !ok {
+		t.Errorf("Expected json.Number, got %T", data.BodyJSON["id"])
+	}
+
+	// Trailing data is still rejected
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader(`{"id":1} x`))
+	req.Header.Set("Content-Type", "application/json")
+	data, err = p.Extract(req)
+	if err != nil {
+		t.Fatalf("Failed to extract request data: %v", err)
+	}
+	if data.BodyJSONValue != nil {
+		t.Errorf("Expected invalid JSON to be ignored, got %v", data.BodyJSONValue)
+	}
+}
+
+// Test number helpers with mixed argument types
+func TestNumberFuncs(t *testing.T) {
+	tests := []struct {
+		name     string
+		got      func() (json.Number, error)
+		expected json.Number
+	}{
+		{"add ints", func() (json.Number, error) { return numberAdd(1, int64(2)) }, "3"},
+		{"add float", func() (json.Number, error) { return numberAdd(0.1, 0.2) }, "0.3"},
+		{"sub string", func() (json.Number, error) { return numberSub("10.5", json.Number("0.25")) }, "10.25"},
+		{"mul uint", func() (json.Number, error) { return numberMul(uint(3), json.Number("1e2")) }, "300"},
+		{"div repeating", func() (json.Number, error) { return numberDiv(1, 3) }, "0.3333333333333333"},
+		{"mod", func() (json.Number, error) { return numberMod(json.Number("12345678901234567890"), 7) }, "1"},
+	}
+	for _, tt := range tests {
+		got, err := tt.got()
+		if err != nil || got != tt.expected {
+			t.Errorf("%s: expected %s, got %s (%v)", tt.name, tt.expected, got, err)
+		}
+	}
+
+	if _, err := numberDiv(1, 0); err == nil {
+		t.Error("Expected error for division by zero")
+	}
+	if _, err := numberAdd("abc", 1); err == nil {
+		t.Error("Expected error for non-numeric argument")
+	}
+	if got, _ := formatNumber(2, json.Number("2.345")); got != "2.35" {
+		t.Errorf("Expected '2.35', got '%s'", got)
+	}
+	if got, err := toInt(json.Number("9007199254740993")); err != nil || got != 9007199254740993 {
+		t.Errorf("Expected 9007199254740993, got %d (%v)", got, err)
+	}
+	if _, err := toInt(json.Number("1.5")); err == nil {
+		t.Error("Expected error converting fraction to int")
+	}
+	if got, err := toFloat("1.5"); err != nil || got != 1.5 {
+		t.Errorf("Expected 1.5, got %v (%v)", got, err)
+	}
+}
@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// OverlayLoader stacks several template loaders. A template is served by the
+// first layer that has it, so earlier layers override later ones.
+type OverlayLoader struct {
+	layers  []TemplateLoader
+	winners map[string]overlayWinner
+	mu      sync.Mutex
+}
+
+// overlayWinner records which layer last served a template and when that changed
+type overlayWinner struct {
+	layer      int
+	switchedAt time.Time
+}
+
+// NewOverlayLoader creates a loader that resolves templates through layers in order
+func NewOverlayLoader(layers ...TemplateLoader) *OverlayLoader {
+	return &OverlayLoader{
+		layers:  layers,
+		winners: make(map[string]overlayWinner),
+	}
+}
+
+// Load implements TemplateLoader
+func (o *OverlayLoader) Load(name string) (string, error) {
+	for i, layer := range o.layers {
+		content, err := layer.Load(name)
+		if errors.Is(err, ErrTemplateNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		o.recordWinner(name, i)
+		return content, nil
+	}
+
+	o.forget(name)
+	return "", ErrTemplateNotFound
+}
+
+// List implements TemplateLoader, returning the de-duplicated names of all layers
+func (o *OverlayLoader) List() ([]string, error) {
+	seen := make(map[string]struct{})
+	var names []string
+
+	for _, layer := range o.layers {
+		layerNames, err := layer.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range layerNames {
+			if _, exists := seen[name]; !exists {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// Watch implements TemplateLoader by watching every layer with the same callback
+func (o *OverlayLoader) Watch(ctx context.Context, callback func(name string)) error {
+	for _, layer := range o.layers {
+		if err := layer.Watch(ctx, callback); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LastModified implements TemplateLoader.
+// The time comes from the winning layer; when a different layer starts winning
+// (an override was added or removed) the switch time is reported if it is newer,
+// so cached templates are invalidated even if the new winner's file is older.
+func (o *OverlayLoader) LastModified(name string) (time.Time, error) {
+	for i, layer := range o.layers {
+		lastMod, err := layer.LastModified(name)
+		if errors.Is(err, ErrTemplateNotFound) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		switchedAt := o.recordWinner(name, i)
+		if switchedAt.After(lastMod) {
+			return switchedAt, nil
+		}
+		return lastMod, nil
+	}
+
+	o.forget(name)
+	return time.Time{}, ErrTemplateNotFound
+}
+
+// recordWinner stores the winning layer for a template and returns the time it last changed
+func (o *OverlayLoader) recordWinner(name string, layer int) time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	winner, exists := o.winners[name]
+	if !exists {
+		o.winners[name] = overlayWinner{layer: layer}
+		return time.Time{}
+	}
+
+	if winner.layer != layer {
+		winner = overlayWinner{layer: layer, switchedAt: time.Now()}
+		o.winners[name] = winner
+	}
+	return winner.switchedAt
+}
+
+// forget drops the winner record of a template that no layer provides anymore
+func (o *OverlayLoader) forget(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.winners, name)
+}
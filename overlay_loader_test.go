@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// Test overlay loader resolution order
+func TestOverlayLoader(t *testing.T) {
+	overrides := NewMemoryLoader()
+	overrides.AddTemplate("greeting", "Tenant hello")
+
+	defaults := fstest.MapFS{
+		"greeting.tmpl": {Data: []byte("Default hello")},
+		"farewell.tmpl": {Data: []byte("Default bye")},
+	}
+
+	loader := NewOverlayLoader(overrides, NewFSLoader(defaults, ".tmpl"))
+
+	content, err := loader.Load("greeting")
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	if content != "Tenant hello" {
+		t.Errorf("Expected 'Tenant hello', got '%s'", content)
+	}
+
+	content, err = loader.Load("farewell")
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	if content != "Default bye" {
+		t.Errorf("Expected 'Default bye', got '%s'", content)
+	}
+
+	names, err := loader.List()
+	if err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "farewell" || names[1] != "greeting" {
+		t.Errorf("Expected [farewell greeting], got %v", names)
+	}
+
+	if _, err := loader.Load("missing"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+	if _, err := loader.LastModified("missing"); err != ErrTemplateNotFound {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+// Test overlay loader invalidates cached templates when overrides come and go
+func TestOverlayLoaderCacheInvalidation(t *testing.T) {
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	upper := fstest.MapFS{}
+	lower := fstest.MapFS{
+		"page.tmpl": {Data: []byte("lower"), ModTime: time.Now()},
+	}
+
+	loader := NewOverlayLoader(NewFSLoader(upper, ".tmpl"), NewFSLoader(lower, ".tmpl"))
+	cache := NewTemplateCache(10, nil)
+
+	render := func() string {
+		tmpl, err := cache.Get("page", loader)
+		if err != nil {
+			t.Fatalf("Failed to get template: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatalf("Failed to execute template: %v", err)
+		}
+		return buf.String()
+	}
+
+	if got := render(); got != "lower" {
+		t.Errorf("Expected 'lower', got '%s'", got)
+	}
+
+	// Adding an override with an older timestamp must still take effect
+	upper["page.tmpl"] = &fstest.MapFile{Data: []byte("upper"), ModTime: old}
+	if _, err := loader.List(); err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	if got := render(); got != "upper" {
+		t.Errorf("Expected 'upper' after adding override, got '%s'", got)
+	}
+
+	// Removing the override falls back to the lower layer
+	delete(upper, "page.tmpl")
+	if got := render(); got != "lower" {
+		t.Errorf("Expected 'lower' after removing override, got '%s'", got)
+	}
+}
+
+// Test overlay loader fans in watch callbacks from all layers
+func TestOverlayLoaderWatch(t *testing.T) {
+	first := &watchRecorder{MemoryLoader: NewMemoryLoader()}
+	second := &watchRecorder{MemoryLoader: NewMemoryLoader()}
+	loader := NewOverlayLoader(first, second)
+
+	var changed []string
+	if err := loader.Watch(context.Background(), func(name string) { changed = append(changed, name) }); err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+
+	first.callback("a")
+	second.callback("b")
+
+	if len(changed) != 2 || changed[0] != "a" || changed[1] != "b" {
+		t.Errorf("Expected [a b], got %v", changed)
+	}
+}
+
+// watchRecorder is a MemoryLoader that keeps the registered watch callback
+type watchRecorder struct {
+	*MemoryLoader
+	callback func(name string)
+}
+
+func (w *watchRecorder) Watch(ctx context.Context, callback func(name string)) error {
+	w.callback = callback
+	return nil
+}
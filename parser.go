@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"text/template"
@@ -14,6 +15,25 @@ type Parser interface {
 	// ParseWith parses a template with custom data and returns the parsed RequestData and any error
 	ParseWith(templateName string, req *http.Request, customData interface{}, output io.Writer) (*RequestData, error)
 
+	// ParseContext is like Parse but stops template execution when ctx is cancelled
+	// or its deadline passes. ctx is available to templates as .Context
+	ParseContext(ctx context.Context, templateName string, request *http.Request, output io.Writer) (*RequestData, error)
+
+	// ParseWithContext is like ParseWith but stops template execution when ctx is cancelled
+	// or its deadline passes. ctx is available to templates as .Context
+	ParseWithContext(ctx context.Context, templateName string, req *http.Request, customData interface{}, output io.Writer) (*RequestData, error)
+
+	// ParseRecords reads an NDJSON body line by line and executes the named template
+	// once per record, with the record available as .Record, writing each output
+	// followed by a newline. The body is streamed rather than buffered, and other
+	// content types fail with ErrUnsupportedContentType. Malformed records and
+	// records whose execution fails are skipped and returned together as RecordErrors
+	ParseRecords(templateName string, req *http.Request, output io.Writer) (*RequestData, error)
+
+	// ParseRecordsContext is like ParseRecords but stops when ctx is cancelled
+	// or its deadline passes
+	ParseRecordsContext(ctx context.Context, templateName string, req *http.Request, output io.Writer) (*RequestData, error)
+
 	// Extract extracts RequestData from the request without parsing any template
 	// If body is provided, it will be used instead of reading from the request's body stream
 	Extract(req *http.Request, body ...[]byte) (*RequestData, error)
@@ -37,6 +57,12 @@ type GenericParser[T any] interface {
 	// ParseWith executes the named template with custom data and returns the result as type T
 	ParseWith(templateName string, request *http.Request, data interface{}) (T, *RequestData, error)
 
+	// ParseContext is like Parse but stops template execution when ctx is done
+	ParseContext(ctx context.Context, templateName string, request *http.Request) (T, *RequestData, error)
+
+	// ParseWithContext is like ParseWith but stops template execution when ctx is done
+	ParseWithContext(ctx context.Context, templateName string, request *http.Request, data interface{}) (T, *RequestData, error)
+
 	// Extract extracts structured data from HTTP request without parsing templates
 	// If body is provided, it will be used instead of reading from the request's body stream
 	Extract(request *http.Request, body ...[]byte) (*RequestData, error)
@@ -64,12 +90,97 @@ type Config struct {
 
 	// FuncMap provides custom template functions
 	FuncMap template.FuncMap
+
+	// Engine selects text/template (default) or html/template for all templates
+	Engine Engine
+
+	// HTMLExtensions compiles templates whose name ends with one of these
+	// extensions with html/template, e.g. ".html" for "mail.html"
+	HTMLExtensions []string
+
+	// MaxOutputBytes limits the output of a single template execution (0 = unlimited).
+	// Executions exceeding it fail with ErrOutputTooLarge. Use WithMaxOutputBytes to
+	// override the limit for a single call
+	MaxOutputBytes int64
+
+	// MaxRepeatBytes caps the result of repeat in the default function map
+	// (0 = the output limit of each execution, or DefaultMaxRepeatBytes without
+	// one). A lower output limit of an execution always applies. A custom FuncMap
+	// keeps its own repeat
+	MaxRepeatBytes int64
+
+	// MaxBodyBytes limits the size of request bodies (0 = unlimited). Larger bodies
+	// fail with ErrBodyTooLarge unless SpillBodyToDisk is set
+	MaxBodyBytes int64
+
+	// SpillBodyToDisk stores bodies larger than MaxBodyBytes in a temporary file
+	// instead of failing; templates then see an empty Body but all other request data.
+	// The file is removed when the parse call returns
+	SpillBodyToDisk bool
+
+	// MaxSpillBytes limits the size of a body spilled to disk (0 = DefaultMaxSpillBytes)
+	MaxSpillBytes int64
+
+	// MultipartMaxMemory is the amount of multipart form data kept in memory
+	// (0 = DefaultMultipartMaxMemory)
+	MultipartMaxMemory int64
+
+	// DisableDecompression keeps compressed request bodies as received instead of
+	// decoding them according to Content-Encoding before extraction
+	DisableDecompression bool
+
+	// MaxDecodedBodyBytes limits the size of decompressed request bodies
+	// (0 = DefaultMaxDecodedBodyBytes)
+	MaxDecodedBodyBytes int64
+
+	// UseJSONNumber decodes JSON body numbers as json.Number instead of float64,
+	// preserving large integers and decimal amounts exactly
+	UseJSONNumber bool
+
+	// CSV controls how text/csv and text/tab-separated-values bodies are decoded
+	CSV CSVOptions
+
+	// XML controls how XML bodies are parsed into RequestData.BodyXML. Set
+	// XML.NamespaceAware to keep namespace URIs, e.g. for SOAP requests
+	XML XMLOptions
+
+	// TrustedProxies lists the IP addresses and CIDR ranges of proxies whose
+	// Forwarded and X-Forwarded-* headers are used to resolve RemoteIP, Host and Scheme
+	TrustedProxies []string
+
+	// BodyDecoders registers decoders keyed by media type, e.g. "application/yaml",
+	// or by structured syntax suffix, e.g. "+json". Their result is available as
+	// RequestData.Parsed. JSON, NDJSON, XML, YAML, TOML and CSV bodies are decoded by default.
+	BodyDecoders map[string]BodyDecoder
 }
 
 // RequestData represents the data structure available to templates
 type RequestData struct {
-	// Request is the original HTTP request
-	Request *http.Request
+	// Request is the original HTTP request. It is not serialized
+	Request *http.Request `json:"-"`
+
+	// Method is the HTTP method
+	Method string
+
+	// Scheme is "http" or "https", or the forwarded protocol when the request
+	// came through a trusted proxy
+	Scheme string
+
+	// Host is the requested host, or the forwarded host when the request came
+	// through a trusted proxy
+	Host string
+
+	// Path is the URL path
+	Path string
+
+	// RemoteIP is the client IP address, resolved through Config.TrustedProxies
+	RemoteIP string
+
+	// ClientCertSubject is the subject of the TLS client certificate, if any
+	ClientCertSubject string
+
+	// Cookies contains the first value of each request cookie by name
+	Cookies map[string]string
 
 	// Headers contains all HTTP headers
 	Headers map[string][]string
@@ -80,15 +191,68 @@ type RequestData struct {
 	// Form contains form data (for POST requests)
 	Form map[string][]string
 
+	// Files contains the uploaded files of a multipart/form-data request by field name
+	Files map[string][]*UploadedFile
+
+	// FormParsed contains the decoded values of non-file multipart parts sent with
+	// a Content-Type that has a BodyDecoder, such as application/json, by field name
+	FormParsed map[string]interface{}
+
 	// Body contains the request body as string
 	Body string
 
 	// BodyJSON contains parsed JSON data when Content-Type is application/json
 	BodyJSON map[string]interface{}
 
+	// BodyJSONValue contains the parsed JSON body of any type: an object, an array,
+	// a string, a number, a boolean or nil for the JSON literal null
+	BodyJSONValue interface{}
+
+	// Parsed contains the body decoded by the BodyDecoder for its media type,
+	// including the built-in JSON, NDJSON, XML, YAML, TOML and CSV decoders
+	Parsed interface{}
+
 	// BodyXML contains parsed XML data when Content-Type is text/xml or application/xml
 	BodyXML map[string]interface{}
 
+	// XMLDoc contains the document tree of an XML body in document order, with
+	// comments, processing instructions, CDATA sections and white space
+	XMLDoc *XMLNode
+
+	// BodyYAML contains parsed YAML data when Content-Type is application/yaml
+	// or another YAML media type and the document is a mapping
+	BodyYAML map[string]interface{}
+
+	// BodyTOML contains parsed TOML data when Content-Type is application/toml
+	BodyTOML map[string]interface{}
+
+	// BodyCSV contains the rows of a CSV or TSV body, including the header row
+	BodyCSV [][]string
+
+	// BodyCSVRecords contains the data rows of a CSV or TSV body keyed by column name
+	BodyCSVRecords []map[string]string
+
+	// BodyRecords contains the records of a newline-delimited JSON body in order
+	BodyRecords []interface{}
+
+	// RecordErrors lists the malformed records of BodyRecords that were skipped
+	RecordErrors RecordErrors
+
+	// Record is the record being rendered by ParseRecords
+	Record interface{}
+
+	// RecordLine is the 1-based line number of Record in the body
+	RecordLine int
+
+	// BodySpilled is true when the body exceeded Config.MaxBodyBytes and was stored
+	// in a temporary file instead of being loaded into Body
+	BodySpilled bool
+
 	// Custom contains any additional custom data
 	Custom interface{}
+
+	// Context is the context passed to ParseContext/ParseWithContext (context.Background
+	// for Parse/ParseWith). Custom template functions can accept it as an argument,
+	// e.g. {{lookup .Context "id"}}, to reach request-scoped values. It is not serialized
+	Context context.Context `json:"-"`
 }
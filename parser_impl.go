@@ -6,10 +6,14 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,12 +22,13 @@ import (
 
 // templateParser implements the Parser interface
 type templateParser struct {
-	config Config
-	cache  *TemplateCache
-	ctx    context.Context
-	cancel context.CancelFunc
-	mu     sync.RWMutex
-	closed bool
+	config         Config
+	trustedProxies []netip.Prefix
+	cache          *TemplateCache
+	ctx            context.Context
+	cancel         context.CancelFunc
+	mu             sync.RWMutex
+	closed         bool
 }
 
 // genericParser implements the GenericParser interface
@@ -51,6 +56,11 @@ func NewGenericParser[T any](config Config) (GenericParser[T], error) {
 
 // newTemplateParser creates the underlying template parser
 func newTemplateParser(config Config) (*templateParser, error) {
+	trustedProxies, err := parseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	// If no TemplateLoader is specified, use MemoryLoader by default
 	if config.TemplateLoader == nil {
 		config.TemplateLoader = NewMemoryLoader()
@@ -59,19 +69,35 @@ func newTemplateParser(config Config) (*templateParser, error) {
 	// Create context for file watching
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Using default function map if not specified
+	// Using default function map if not specified, file functions capped like the output.
+	// Its repeat is bound to each execution to be capped at the execution's output limit
+	var execFuncs executionFuncs
 	if config.FuncMap == nil {
-		config.FuncMap = DefaultFuncMap()
+		config.FuncMap = DefaultFuncMapWithLimit(config.MaxOutputBytes)
+		maxRepeat := config.MaxRepeatBytes
+		config.FuncMap["repeat"] = newRepeatFunc(func() int64 { return repeatLimit(maxRepeat, 0) })
+		execFuncs = executionFuncs{
+			"repeat": func(state *executionState) interface{} {
+				return newRepeatFunc(func() int64 { return repeatLimit(maxRepeat, state.limit) })
+			},
+		}
+		// Let the XML functions resolve both forms of configured namespaces
+		for name, fn := range (XMLHelper{Namespaces: config.XML.Namespaces}).FuncMap() {
+			config.FuncMap[name] = fn
+		}
 	}
 
 	// Create template cache
 	cache := NewTemplateCache(config.MaxCacheSize, config.FuncMap)
+	cache.execFuncs = execFuncs
+	cache.SetEngine(config.Engine, config.HTMLExtensions...)
 
 	parser := &templateParser{
-		config: config,
-		cache:  cache,
-		ctx:    ctx,
-		cancel: cancel,
+		config:         config,
+		trustedProxies: trustedProxies,
+		cache:          cache,
+		ctx:            ctx,
+		cancel:         cancel,
 	}
 
 	// Start file watching if enabled
@@ -88,16 +114,26 @@ func newTemplateParser(config Config) (*templateParser, error) {
 
 // Parse implements GenericParser - executes template and returns result as type T
 func (g *genericParser[T]) Parse(templateName string, request *http.Request) (T, *RequestData, error) {
-	return g.ParseWith(templateName, request, nil)
+	return g.ParseWithContext(context.Background(), templateName, request, nil)
 }
 
 // ParseWith implements GenericParser - executes template with custom data and returns result as type T
 func (g *genericParser[T]) ParseWith(templateName string, request *http.Request, data interface{}) (T, *RequestData, error) {
+	return g.ParseWithContext(context.Background(), templateName, request, data)
+}
+
+// ParseContext implements GenericParser - executes template under ctx and returns result as type T
+func (g *genericParser[T]) ParseContext(ctx context.Context, templateName string, request *http.Request) (T, *RequestData, error) {
+	return g.ParseWithContext(ctx, templateName, request, nil)
+}
+
+// ParseWithContext implements GenericParser - executes template with custom data under ctx and returns result as type T
+func (g *genericParser[T]) ParseWithContext(ctx context.Context, templateName string, request *http.Request, data interface{}) (T, *RequestData, error) {
 	var zero T
 
 	// Parse template to string buffer first
 	var buf bytes.Buffer
-	requestData, err := g.templateParser.ParseWith(templateName, request, data, &buf)
+	requestData, err := g.templateParser.ParseWithContext(ctx, templateName, request, data, &buf)
 	if err != nil {
 		return zero, nil, err
 	}
@@ -156,7 +192,10 @@ func convertToType[T any](s string) (T, error) {
 		var target T
 		err := json.Unmarshal([]byte(s), &target)
 		if err != nil {
-			return zero, fmt.Errorf("cannot unmarshal '%s' to type %T: %w", s, zero, err)
+			// Structs and maps also accept YAML output
+			if !acceptsYAML(reflect.TypeOf(zero)) || yamlToType(s, &target) != nil {
+				return zero, fmt.Errorf("cannot unmarshal '%s' to type %T: %w", s, zero, err)
+			}
 		}
 		result = target
 	}
@@ -166,11 +205,21 @@ func convertToType[T any](s string) (T, error) {
 
 // Parse implements Parser
 func (p *templateParser) Parse(templateName string, request *http.Request, output io.Writer) (*RequestData, error) {
-	return p.ParseWith(templateName, request, nil, output)
+	return p.ParseWithContext(context.Background(), templateName, request, nil, output)
 }
 
 // ParseWith implements Parser
 func (p *templateParser) ParseWith(templateName string, request *http.Request, data interface{}, output io.Writer) (*RequestData, error) {
+	return p.ParseWithContext(context.Background(), templateName, request, data, output)
+}
+
+// ParseContext implements Parser
+func (p *templateParser) ParseContext(ctx context.Context, templateName string, request *http.Request, output io.Writer) (*RequestData, error) {
+	return p.ParseWithContext(ctx, templateName, request, nil, output)
+}
+
+// ParseWithContext implements Parser
+func (p *templateParser) ParseWithContext(ctx context.Context, templateName string, request *http.Request, data interface{}, output io.Writer) (*RequestData, error) {
 	p.mu.RLock()
 	if p.closed {
 		p.mu.RUnlock()
@@ -178,11 +227,12 @@ func (p *templateParser) ParseWith(templateName string, request *http.Request, d
 	}
 	p.mu.RUnlock()
 
-	// Create re-readable request
-	req, err := NewRereadableRequest(request)
+	// Create re-readable request, a spilled body is removed when parsing ends
+	req, err := NewRereadableRequestWithOptions(request, p.extractOptions())
 	if err != nil {
 		return nil, err
 	}
+	defer req.Close()
 
 	// Extract request data
 	requestData, err := req.Extract()
@@ -190,17 +240,27 @@ func (p *templateParser) ParseWith(templateName string, request *http.Request, d
 		return nil, err
 	}
 
-	// Set custom data for ParseWith
+	// Set custom data for ParseWith and expose the context to template functions
 	requestData.Custom = data
+	requestData.Context = ctx
 
 	// Get template from cache
-	tmpl, err := p.cache.Get(templateName, p.config.TemplateLoader)
+	executor, err := p.cache.executor(templateName, p.config.TemplateLoader)
 	if err != nil {
 		return requestData, err
 	}
 
-	// Execute template
-	err = tmpl.Execute(output, requestData)
+	// Limit the output size if configured for the parser or this call
+	limit := p.config.MaxOutputBytes
+	if override, ok := maxOutputBytesFrom(ctx); ok {
+		limit = override
+	}
+	if limit > 0 {
+		output = &limitWriter{w: output, limit: limit}
+	}
+
+	// Execute template, stopping when the context is done
+	err = executor.execute(ctx, output, requestData, limit)
 
 	// Reset request body for potential reuse
 	req.Reset()
@@ -208,6 +268,96 @@ func (p *templateParser) ParseWith(templateName string, request *http.Request, d
 	return requestData, err
 }
 
+// ParseRecords implements Parser
+func (p *templateParser) ParseRecords(templateName string, request *http.Request, output io.Writer) (*RequestData, error) {
+	return p.ParseRecordsContext(context.Background(), templateName, request, output)
+}
+
+// ParseRecordsContext implements Parser
+func (p *templateParser) ParseRecordsContext(ctx context.Context, templateName string, request *http.Request, output io.Writer) (*RequestData, error) {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return nil, ErrParserClosed
+	}
+	p.mu.RUnlock()
+
+	options := p.extractOptions()
+	contentType := request.Header.Get("Content-Type")
+	ndjson, ok := findBodyDecoder(contentType, options).(NDJSONDecoder)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not NDJSON", ErrUnsupportedContentType, contentType)
+	}
+
+	// Extract the request data without the body, which is streamed record by record
+	req, err := NewRereadableRequestWithOptions(request, options, []byte{})
+	if err != nil {
+		return nil, err
+	}
+	requestData, err := req.Extract()
+	if err != nil {
+		return nil, err
+	}
+	requestData.Context = ctx
+
+	// Get template from cache
+	executor, err := p.cache.executor(templateName, p.config.TemplateLoader)
+	if err != nil {
+		return requestData, err
+	}
+
+	// The output limit applies to the whole stream
+	limit := p.config.MaxOutputBytes
+	if override, ok := maxOutputBytesFrom(ctx); ok {
+		limit = override
+	}
+	if limit > 0 {
+		output = &limitWriter{w: output, limit: limit}
+	}
+
+	stream, err := newRecordStream(request, options)
+	if err != nil {
+		return requestData, err
+	}
+	defer stream.Close()
+
+	var execErrs RecordErrors
+	var buf bytes.Buffer
+	errs, err := ndjson.scanRecords(stream, DefaultMaxRecordBytes, func(record interface{}, line int) error {
+		recordData := *requestData
+		recordData.Record = record
+		recordData.RecordLine = line
+
+		// Render each record separately so a failing record writes nothing
+		buf.Reset()
+		var recordOutput io.Writer = &buf
+		if limit > 0 {
+			recordOutput = &limitWriter{w: &buf, limit: limit}
+		}
+		if err := executor.execute(ctx, recordOutput, &recordData, limit); err != nil {
+			if ctx.Err() != nil || errors.Is(err, ErrOutputTooLarge) {
+				return err
+			}
+			execErrs = append(execErrs, &RecordError{Line: line, Err: err})
+			return nil
+		}
+
+		buf.WriteByte('\n')
+		_, err := output.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		return requestData, err
+	}
+
+	errs = append(errs, execErrs...)
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+		return requestData, errs
+	}
+	return requestData, nil
+}
+
 // Extract extracts RequestData from the request without parsing any template
 func (p *templateParser) Extract(req *http.Request, body ...[]byte) (*RequestData, error) {
 	p.mu.RLock()
@@ -218,10 +368,11 @@ func (p *templateParser) Extract(req *http.Request, body ...[]byte) (*RequestDat
 	p.mu.RUnlock()
 
 	// Create re-readable request with optional body
-	rereadable, err := NewRereadableRequest(req, body...)
+	rereadable, err := NewRereadableRequestWithOptions(req, p.extractOptions(), body...)
 	if err != nil {
 		return nil, err
 	}
+	defer rereadable.Close()
 
 	// Extract request data (no longer pass customData, it's removed from this method)
 	requestData, err := rereadable.Extract()
@@ -235,6 +386,23 @@ func (p *templateParser) Extract(req *http.Request, body ...[]byte) (*RequestDat
 	return requestData, nil
 }
 
+// extractOptions returns the request extraction options from the parser configuration
+func (p *templateParser) extractOptions() ExtractOptions {
+	return ExtractOptions{
+		MaxBodyBytes:         p.config.MaxBodyBytes,
+		SpillBodyToDisk:      p.config.SpillBodyToDisk,
+		MaxSpillBytes:        p.config.MaxSpillBytes,
+		MultipartMaxMemory:   p.config.MultipartMaxMemory,
+		DisableDecompression: p.config.DisableDecompression,
+		MaxDecodedBodyBytes:  p.config.MaxDecodedBodyBytes,
+		UseJSONNumber:        p.config.UseJSONNumber,
+		CSV:                  p.config.CSV,
+		XML:                  p.config.XML,
+		BodyDecoders:         p.config.BodyDecoders,
+		TrustedProxies:       p.trustedProxies,
+	}
+}
+
 // UpdateTemplate implements Parser
 func (p *templateParser) UpdateTemplate(name string, content string) error {
 	p.mu.RLock()
@@ -255,16 +423,13 @@ func (p *templateParser) UpdateTemplate(name string, content string) error {
 		return nil
 	}
 
-	// Parse the template content
-	tmpl, err := template.New(name).Funcs(p.config.FuncMap).Parse(content)
-	if err != nil {
+	// Parse the template content, resolving partials through the configured loader,
+	// and update the cache directly with the parsed template
+	if _, err := p.cache.Compile(name, content, hashString, p.config.TemplateLoader); err != nil {
 		return err
 	}
 
-	slog.Info("Updated template", "name", name, "hash", hashString)
-
-	// Update the cache directly with the parsed template
-	p.cache.Set(name, tmpl, hashString)
+	slog.Info("Updated template", "name", name, "hash", hashString, "engine", p.cache.EngineFor(name))
 	return nil
 }
 
@@ -308,9 +473,17 @@ func (p *templateParser) GetCacheStats() CacheStats {
 
 // Helper function to create default function map with useful template functions
 func DefaultFuncMap() template.FuncMap {
-	xmlHelper := XMLHelper{}
+	return DefaultFuncMapWithLimit(0)
+}
 
-	return template.FuncMap{
+// DefaultFuncMapWithLimit creates the default function map with the result of
+// repeat capped at maxBytes (0 = unlimited). repeat fails with ErrOutputTooLarge
+// when the cap would be exceeded. The file functions always read at most
+// DefaultMaxFileReadBytes, or maxBytes when that is lower. A parser
+// without a custom FuncMap caps repeat per execution instead, see
+// Config.MaxRepeatBytes.
+func DefaultFuncMapWithLimit(maxBytes int64) template.FuncMap {
+	funcMap := template.FuncMap{
 		// String functions
 		"upper": func(s string) string {
 			return strings.ToUpper(s)
@@ -348,20 +521,53 @@ func DefaultFuncMap() template.FuncMap {
 		"trimSuffix": func(s, suffix string) string {
 			return strings.TrimSuffix(s, suffix)
 		},
-		"repeat": func(s string, count int) string {
-			return strings.Repeat(s, count)
-		},
+		"repeat": newRepeatFunc(func() int64 { return maxBytes }),
 		"substr": func(s string, start, length int) string {
-			if start < 0 || start >= len(s) {
+			if start < 0 || start >= len(s) || length <= 0 {
 				return ""
 			}
 			end := start + length
-			if end > len(s) {
+			if end > len(s) || end < start {
 				end = len(s)
 			}
 			return s[start:end]
 		},
 
+		// Number functions, exact for json.Number values (see Config.UseJSONNumber)
+		"add":          numberAdd,
+		"sub":          numberSub,
+		"mul":          numberMul,
+		"div":          numberDiv,
+		"mod":          numberMod,
+		"formatNumber": formatNumber,
+		"toInt":        toInt,
+		"toFloat":      toFloat,
+
+		// CSV functions, operating on the request data of a CSV body or a *CSVTable
+		"csvHeader":      csvHeader,
+		"csvColumn":      csvColumn,
+		"csvColumnIndex": csvColumnIndex,
+		"csvField":       csvField,
+
+		// File functions for RequestData.Files, capped at DefaultMaxFileReadBytes or a lower maxBytes
+		"fileText":   fileText(maxBytes),
+		"fileBase64": fileBase64(maxBytes),
+
+		// XML output functions
+		"xmlEscape": func(v interface{}) string {
+			return escapeXMLText(xmlScalar(v))
+		},
+		"xmlEscapeAttr": func(v interface{}) string {
+			return escapeXMLAttr(xmlScalar(v))
+		},
+		"xmlRender":    xmlRender,
+		"soapEnvelope": soapEnvelope,
+
+		// Conversion functions
+		"toJSON":  toJSON,
+		"fromXML": fromXML,
+		"toXML":   toXML,
+
 		// Utility functions
 		"default": func(defaultValue, value interface{}) interface{} {
 			if value == nil {
@@ -383,19 +589,17 @@ func DefaultFuncMap() template.FuncMap {
 		"form": func(req *http.Request, name string) string {
 			return req.FormValue(name)
 		},
+		"cookie": func(req *http.Request, name string) string {
+			if cookie, err := req.Cookie(name); err == nil {
+				return cookie.Value
+			}
+			return ""
+		},
+	}
 
-		// XML helper functions
-		"xmlAttr":       xmlHelper.GetXMLAttribute,
-		"xmlAttrArray":  xmlHelper.GetXMLAttributeArray,
-		"xmlValue":      xmlHelper.GetXMLValue,
-		"xmlValueArray": xmlHelper.GetXMLValueArray,
-		"xmlText":       xmlHelper.GetXMLText,
-		"xmlTextArray":  xmlHelper.GetXMLTextArray,
-		"hasXMLAttr":    xmlHelper.HasXMLAttribute,
-		"hasXMLElement": xmlHelper.HasXMLElement,
-		"isXMLArray":    xmlHelper.IsXMLArray,
-		"xmlArrayLen":   xmlHelper.XMLArrayLength,
-		"xmlAttrs":      xmlHelper.ListXMLAttributes,
-		"xmlElements":   xmlHelper.ListXMLElements,
+	// XML helper functions
+	for name, fn := range (XMLHelper{}).FuncMap() {
+		funcMap[name] = fn
 	}
+	return funcMap
 }
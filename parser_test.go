@@ -1406,9 +1406,9 @@ func TestDefaultFuncMapStringFunctions(t *testing.T) {
 	}
 
 	// Test repeat function
-	repeatFunc := funcMap["repeat"].(func(string, int) string)
-	repeated := repeatFunc("a", 3)
-	if repeated != "aaa" {
+	repeatFunc := funcMap["repeat"].(func(string, int) (string, error))
+	repeated, err := repeatFunc("a", 3)
+	if err != nil || repeated != "aaa" {
 		t.Errorf("Expected 'aaa', got '%s'", repeated)
 	}
 
@@ -1,10 +1,15 @@
 package parser
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"os"
 	"strings"
 )
 
@@ -14,27 +19,102 @@ var xmlContentTypes = []string{
 	"application/soap+xml",
 }
 
+// DefaultMultipartMaxMemory is the default amount of multipart form data kept in memory
+const DefaultMultipartMaxMemory = 32 << 20 // 32 MB
+
+// DefaultMaxSpillBytes is the default size limit of bodies spilled to disk
+const DefaultMaxSpillBytes = 1 << 30 // 1 GB
+
+// ExtractOptions controls how request bodies are read and extracted
+type ExtractOptions struct {
+	// MaxBodyBytes limits the size of the request body (0 = unlimited).
+	// Larger bodies fail with ErrBodyTooLarge unless SpillBodyToDisk is set
+	MaxBodyBytes int64
+
+	// SpillBodyToDisk stores bodies larger than MaxBodyBytes in a temporary file
+	// instead of failing. Spilled bodies are not loaded into RequestData.Body, but
+	// headers, query and form data are still extracted
+	SpillBodyToDisk bool
+
+	// MaxSpillBytes limits the size of a body spilled to disk
+	// (0 = DefaultMaxSpillBytes). Larger bodies fail with ErrBodyTooLarge
+	MaxSpillBytes int64
+
+	// MultipartMaxMemory is the amount of multipart form data kept in memory,
+	// the rest is stored in temporary files (0 = DefaultMultipartMaxMemory)
+	MultipartMaxMemory int64
+
+	// DisableDecompression keeps bodies with a Content-Encoding (gzip, deflate,
+	// br, zstd) compressed instead of decoding them before extraction
+	DisableDecompression bool
+
+	// MaxDecodedBodyBytes limits the size of a decompressed body
+	// (0 = DefaultMaxDecodedBodyBytes). Larger bodies fail with ErrBodyTooLarge
+	MaxDecodedBodyBytes int64
+
+	// UseJSONNumber decodes numbers in JSON bodies as json.Number instead of float64
+	UseJSONNumber bool
+
+	// CSV controls how text/csv and text/tab-separated-values bodies are decoded
+	CSV CSVOptions
+
+	// XML controls how XML bodies are parsed, e.g. whether namespaces are kept
+	XML XMLOptions
+
+	// TrustedProxies are the proxies whose forwarding headers are honoured when
+	// resolving the client IP, host and scheme
+	TrustedProxies []netip.Prefix
+
+	// BodyDecoders maps media types ("application/yaml") or structured syntax
+	// suffixes ("+json") to decoders, overriding the built-in JSON and XML decoders
+	BodyDecoders map[string]BodyDecoder
+}
+
 // RereadableRequest wraps an HTTP request to make it re-readable
 type RereadableRequest struct {
 	*http.Request
-	body         []byte
-	providedBody bool // true if body was provided externally, false if read from request
+	body         []byte // decoded body used for extraction
+	rawBody      []byte // body as received, before Content-Encoding decoding
+	decoded      bool   // true if body was decompressed according to Content-Encoding
+	providedBody bool   // true if body was provided externally, false if read from request
+	spilled      bool   // true if the body exceeded the size limit and lives in a temporary file
+	options      ExtractOptions
 }
 
 // NewRereadableRequest creates a new re-readable HTTP request
 // If body is provided, it will be used instead of reading from the request's body stream
 func NewRereadableRequest(r *http.Request, body ...[]byte) (*RereadableRequest, error) {
+	return NewRereadableRequestWithOptions(r, ExtractOptions{}, body...)
+}
+
+// NewRereadableRequestWithOptions creates a new re-readable HTTP request that reads
+// and extracts the body according to options
+// If body is provided, it will be used instead of reading from the request's body stream
+func NewRereadableRequestWithOptions(r *http.Request, options ExtractOptions, body ...[]byte) (*RereadableRequest, error) {
 	var requestBody []byte
 	var err error
 
 	// Use provided body if available, otherwise read from request
-	var providedBody bool
+	var providedBody, spilled bool
 	if len(body) > 0 && body[0] != nil {
 		requestBody = body[0]
 		providedBody = true
+		if options.MaxBodyBytes > 0 && int64(len(requestBody)) > options.MaxBodyBytes {
+			return nil, fmt.Errorf("%w: limit %d bytes", ErrBodyTooLarge, options.MaxBodyBytes)
+		}
 	} else if r.Body != nil {
 		providedBody = false
-		if rr, ok := r.Body.(Reader); ok {
+		if sb, ok := r.Body.(*spilledBody); ok {
+			// Body was already spilled by a previous read
+			spilled = true
+			if _, err := sb.Reset(); err != nil {
+				return nil, err
+			}
+		} else if options.MaxBodyBytes > 0 {
+			if requestBody, spilled, err = readLimitedBody(r, options); err != nil {
+				return nil, err
+			}
+		} else if rr, ok := r.Body.(Reader); ok {
 			requestBody, err = rr.ReadAll()
 			if err != nil {
 				return nil, err
@@ -48,11 +128,36 @@ func NewRereadableRequest(r *http.Request, body ...[]byte) (*RereadableRequest,
 		}
 	}
 
+	// Decode compressed bodies; the original bytes stay in the request body for pass-through
+	rawBody := requestBody
+	decodedBody := false
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && len(requestBody) > 0 && !options.DisableDecompression {
+		maxDecoded := options.MaxDecodedBodyBytes
+		if maxDecoded <= 0 {
+			maxDecoded = DefaultMaxDecodedBodyBytes
+		}
+		decoded, err := decodeContentEncoding(requestBody, encoding, maxDecoded)
+		if errors.Is(err, ErrBodyTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			// Log decoding failure but continue with the body as received
+			slog.Warn("Failed to decode request body", "error", err, "content_encoding", encoding)
+		} else {
+			requestBody = decoded
+			decodedBody = true
+		}
+	}
+
 	// Create wrapper that uses the original request but makes body re-readable
 	req := &RereadableRequest{
 		Request:      r, // Use the original request, don't create a copy
 		body:         requestBody,
+		rawBody:      rawBody,
+		decoded:      decodedBody,
 		providedBody: providedBody,
+		spilled:      spilled,
+		options:      options,
 	}
 
 	// Reset the original request's body to be re-readable (only if body wasn't provided externally)
@@ -63,6 +168,54 @@ func NewRereadableRequest(r *http.Request, body ...[]byte) (*RereadableRequest,
 	return req, nil
 }
 
+// readLimitedBody reads the request body up to options.MaxBodyBytes. Larger bodies
+// fail with ErrBodyTooLarge, or are spilled to a temporary file if enabled, in
+// which case no bytes are returned and spilled is true.
+func readLimitedBody(r *http.Request, options ExtractOptions) (body []byte, spilled bool, err error) {
+	limit := options.MaxBodyBytes
+
+	if rr, ok := r.Body.(Reader); ok {
+		// Re-readable bodies are already in memory
+		if body, err = rr.ReadAll(); err != nil {
+			return nil, false, err
+		}
+		rr.Reset()
+		if int64(len(body)) > limit {
+			return nil, false, fmt.Errorf("%w: limit %d bytes", ErrBodyTooLarge, limit)
+		}
+		return body, false, nil
+	}
+
+	// Read one byte past the limit to detect oversized bodies
+	body, err = io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(body)) <= limit {
+		r.Body.Close()
+		r.Body = RepeatedlySeekableReadCloser{Reader: bytes.NewReader(body)}
+		return body, false, nil
+	}
+
+	if !options.SpillBodyToDisk {
+		r.Body.Close()
+		return nil, false, fmt.Errorf("%w: limit %d bytes", ErrBodyTooLarge, limit)
+	}
+
+	maxSpill := options.MaxSpillBytes
+	if maxSpill <= 0 {
+		maxSpill = DefaultMaxSpillBytes
+	}
+	sb, err := newSpilledBody(io.MultiReader(bytes.NewReader(body), r.Body), maxSpill)
+	r.Body.Close()
+	if err != nil {
+		return nil, false, err
+	}
+	r.Body = sb
+	return nil, true, nil
+}
+
 // resetBody resets the body reader to the beginning
 func (r *RereadableRequest) resetBody() {
 	// If body was provided externally, no need to reset the reader
@@ -81,6 +234,20 @@ func (r *RereadableRequest) Reset() {
 	r.resetBody()
 }
 
+// Spilled reports whether the body exceeded MaxBodyBytes and was stored in a temporary file
+func (r *RereadableRequest) Spilled() bool {
+	return r.spilled
+}
+
+// Close removes the temporary file of a spilled body, after which the request
+// body can no longer be read. It does nothing for bodies kept in memory.
+func (r *RereadableRequest) Close() error {
+	if sb, ok := r.Request.Body.(*spilledBody); ok && r.spilled {
+		return sb.Close()
+	}
+	return nil
+}
+
 // Body returns the request body as a string
 func (r *RereadableRequest) Body() string {
 	return string(r.body)
@@ -94,12 +261,31 @@ func (r *RereadableRequest) BodyBytes() []byte {
 	return result
 }
 
+// RawBodyBytes returns the request body as received, before Content-Encoding decoding
+func (r *RereadableRequest) RawBodyBytes() []byte {
+	result := make([]byte, len(r.rawBody))
+	copy(result, r.rawBody)
+	return result
+}
+
+// Decoded reports whether the body was decompressed according to its Content-Encoding
+func (r *RereadableRequest) Decoded() bool {
+	return r.decoded
+}
+
 // Extract extracts structured data from the HTTP request for template use
 func (r *RereadableRequest) Extract() (*RequestData, error) {
 	// Parse form data if not already parsed
 	if r.Request.Form == nil {
 		r.Reset() // Ensure body is readable
 
+		// Parse forms from the decoded body, then restore the original stream
+		if r.Decoded() && !r.providedBody {
+			original := r.Request.Body
+			r.Request.Body = RepeatedlySeekableReadCloser{Reader: bytes.NewReader(r.body)}
+			defer func() { r.Request.Body = original }()
+		}
+
 		// Parse form based on content type
 		contentType := r.Header.Get("Content-Type")
 		if strings.Contains(contentType, "application/x-www-form-urlencoded") {
@@ -107,7 +293,11 @@ func (r *RereadableRequest) Extract() (*RequestData, error) {
 				return nil, err
 			}
 		} else if strings.Contains(contentType, "multipart/form-data") {
-			if err := r.Request.ParseMultipartForm(32 << 20); err != nil { // 32 MB max memory
+			maxMemory := r.options.MultipartMaxMemory
+			if maxMemory <= 0 {
+				maxMemory = DefaultMultipartMaxMemory
+			}
+			if err := r.Request.ParseMultipartForm(maxMemory); err != nil {
 				return nil, err
 			}
 		}
@@ -138,50 +328,180 @@ func (r *RereadableRequest) Extract() (*RequestData, error) {
 		}
 	}
 
-	// Parse JSON body if content type is JSON
+	// Describe uploaded files and decode structured parts
+	var files map[string][]*UploadedFile
+	var formParsed map[string]interface{}
+	if r.Request.MultipartForm != nil {
+		maxMemory := r.options.MultipartMaxMemory
+		if maxMemory <= 0 {
+			maxMemory = DefaultMultipartMaxMemory
+		}
+		var err error
+		if files, err = extractFiles(r.Request.MultipartForm, r.options, maxMemory); err != nil {
+			return nil, err
+		}
+		if !r.spilled {
+			formParsed = extractFormParts(r.body, r.Header.Get("Content-Type"), r.options, maxMemory)
+		}
+	}
+
+	// Transcode non-UTF-8 bodies so templates always see UTF-8 text
+	body, charset, err := decodeCharset(r.body, r.Header.Get("Content-Type"))
+	transcoded := err == nil
+	if err != nil {
+		// Log charset failure but continue with the body as received. Only formats
+		// that are UTF-8 by definition are still decoded, others would be misread
+		slog.Warn("Failed to decode body charset", "error", err, "content_type", r.Header.Get("Content-Type"))
+	} else if charset != "" {
+		slog.Debug("Transcoded request body to UTF-8", "charset", charset)
+	}
+
+	// Decode the body with the decoder registered for its media type
+	var parsed interface{}
 	var bodyJSON map[string]interface{}
+	var bodyJSONValue interface{}
 	var bodyXML map[string]interface{}
+	var bodyYAML map[string]interface{}
+	var bodyTOML map[string]interface{}
+	var bodyRecords []interface{}
+	var recordErrors RecordErrors
+	var bodyCSV [][]string
+	var bodyCSVRecords []map[string]string
 
-	contentType := strings.ToLower(r.Header.Get("Content-Type"))
-	if strings.Contains(contentType, "application/json") && len(r.body) > 0 {
-		var parsedJSON map[string]interface{}
-		if err := json.Unmarshal(r.body, &parsedJSON); err != nil {
-			// Log JSON parsing failure but continue processing
-			slog.Warn("Failed to parse JSON body", "error", err, "content_type", contentType)
-			// Create error structure similar to XML for consistency
-			bodyJSON = nil
+	contentType := r.Header.Get("Content-Type")
+	decoder := findBodyDecoder(contentType, r.options)
+	if !transcoded && !isUTF8ContentType(contentType) {
+		decoder = nil
+	}
+	if ndjson, ok := decoder.(NDJSONDecoder); ok && len(body) > 0 {
+		// Records are decoded line by line so malformed lines do not discard the batch
+		var err error
+		bodyRecords, err = ndjson.decodeRecords(body)
+		if errors.As(err, &recordErrors) {
+			slog.Warn("Skipped malformed records", "count", len(recordErrors), "error", err, "content_type", contentType)
+		} else if err != nil {
+			slog.Warn("Failed to decode body", "error", err, "content_type", contentType)
+		}
+		parsed = bodyRecords
+	} else if decoder != nil && len(body) > 0 {
+		value, err := decoder.Decode(body, contentType)
+		if err != nil {
+			// Log decoding failure but continue processing
+			slog.Warn("Failed to decode body", "error", err, "content_type", contentType)
 		} else {
-			// Wrap successful JSON parsing in standard structure for consistency
-			bodyJSON = parsedJSON
-		}
-	} else {
-		// Parse XML body if content type is XML
-		if len(r.body) > 0 {
-			for _, ct := range xmlContentTypes {
-				if strings.Contains(contentType, ct) {
-					// Parse XML into structured format
-					parsedXML, err := parseXMLToGeneric(string(r.body))
-					if err != nil {
-						// Log XML parsing failure but continue processing
-						slog.Warn("Failed to parse XML body", "error", err, "content_type", contentType)
-						bodyXML = nil
-					} else {
-						bodyXML = parsedXML
-					}
-					break
-				}
+			parsed = value
+			// The built-in decoders also populate the format-specific fields
+			switch decoder.(type) {
+			case JSONDecoder:
+				bodyJSONValue = value
+				bodyJSON, _ = value.(map[string]interface{})
+			case XMLDecoder:
+				bodyXML, _ = value.(map[string]interface{})
+			case YAMLDecoder:
+				bodyYAML, _ = value.(map[string]interface{})
+			case TOMLDecoder:
+				bodyTOML, _ = value.(map[string]interface{})
+			case CSVDecoder:
+				table := value.(*CSVTable)
+				bodyCSV = table.Rows
+				bodyCSVRecords = table.Records
 			}
 		}
 	}
 
+	// XML bodies are also kept as a document tree
+	var xmlDoc *XMLNode
+	if isXMLContentType(contentType) && len(body) > 0 {
+		var err error
+		if xmlDoc, err = parseXMLDocument(string(body), transcoded); err != nil {
+			slog.Debug("Failed to build XML document tree", "error", err)
+		}
+	}
+
+	client := resolveClient(r.Request, r.options.TrustedProxies)
+
 	return &RequestData{
-		Request:  r.Request,
-		Headers:  headers,
-		Query:    query,
-		Form:     form,
-		Body:     r.Body(),
-		BodyJSON: bodyJSON,
-		BodyXML:  bodyXML,
-		Custom:   nil, // Custom data is no longer supported in Extract method
+		Request:           r.Request,
+		Method:            r.Method,
+		Scheme:            client.scheme,
+		Host:              client.host,
+		Path:              r.URL.Path,
+		RemoteIP:          client.ip,
+		ClientCertSubject: clientCertSubject(r.Request),
+		Cookies:           requestCookies(r.Request),
+		Headers:           headers,
+		Query:             query,
+		Form:              form,
+		Body:              string(body),
+		BodyJSON:          bodyJSON,
+		BodyJSONValue:     bodyJSONValue,
+		Parsed:            parsed,
+		BodyXML:           bodyXML,
+		XMLDoc:            xmlDoc,
+		BodyYAML:          bodyYAML,
+		BodyTOML:          bodyTOML,
+		BodyCSV:           bodyCSV,
+		BodyCSVRecords:    bodyCSVRecords,
+		BodyRecords:       bodyRecords,
+		RecordErrors:      recordErrors,
+		Files:             files,
+		FormParsed:        formParsed,
+		BodySpilled:       r.spilled,
+		Custom:            nil, // Custom data is no longer supported in Extract method
 	}, nil
 }
+
+// spilledBody is a re-readable request body backed by a temporary file.
+// Close removes the file; use Reset to rewind it.
+type spilledBody struct {
+	*os.File
+}
+
+// newSpilledBody copies src into a new temporary file, failing with
+// ErrBodyTooLarge if src is larger than maxBytes
+func newSpilledBody(src io.Reader, maxBytes int64) (*spilledBody, error) {
+	file, err := os.CreateTemp("", "parser-body-*")
+	if err != nil {
+		return nil, err
+	}
+
+	written, err := io.Copy(file, io.LimitReader(src, maxBytes+1))
+	if err == nil && written > maxBytes {
+		err = fmt.Errorf("%w: spilled body exceeds %d bytes", ErrBodyTooLarge, maxBytes)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &spilledBody{File: file}, nil
+}
+
+// Reset implements Reader by rewinding the file
+func (s *spilledBody) Reset() (io.ReadCloser, error) {
+	_, err := s.File.Seek(0, io.SeekStart)
+	return s, err
+}
+
+// ReadAll implements Reader by reading the whole file into memory
+func (s *spilledBody) ReadAll() ([]byte, error) {
+	if _, err := s.Reset(); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(s.File)
+}
+
+// Close closes and removes the temporary file
+func (s *spilledBody) Close() error {
+	err := s.File.Close()
+	if removeErr := os.Remove(s.File.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
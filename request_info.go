@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies parses IP addresses and CIDR ranges of trusted proxies
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy reports whether addr belongs to one of the trusted proxies
+func isTrustedProxy(addr netip.Addr, proxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNodeAddr parses an address as found in RemoteAddr, X-Forwarded-For or a
+// Forwarded "for" parameter, with or without a port
+func parseNodeAddr(node string) (netip.Addr, bool) {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	addr, err := netip.ParseAddr(node)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// forwardedElement is one hop of a Forwarded header (RFC 7239)
+type forwardedElement struct {
+	forNode string
+	host    string
+	proto   string
+}
+
+// parseForwarded parses all Forwarded header values into hops, in order
+func parseForwarded(values []string) []forwardedElement {
+	var elements []forwardedElement
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var e forwardedElement
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				val = strings.Trim(strings.TrimSpace(val), `"`)
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "for":
+					e.forNode = val
+				case "host":
+					e.host = val
+				case "proto":
+					e.proto = strings.ToLower(val)
+				}
+			}
+			elements = append(elements, e)
+		}
+	}
+	return elements
+}
+
+// clientInfo holds the client facts resolved through trusted proxies
+type clientInfo struct {
+	ip     string
+	host   string
+	scheme string
+}
+
+// resolveClient determines the client IP, host and scheme of r. Forwarding
+// headers are only honoured when the direct peer is a trusted proxy; the client
+// is then the right-most address of the chain that is not a trusted proxy, and
+// the host and scheme are those recorded for that hop. Forwarded takes
+// precedence over X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto.
+func resolveClient(r *http.Request, proxies []netip.Prefix) clientInfo {
+	info := clientInfo{host: r.Host, scheme: "http"}
+	if r.TLS != nil {
+		info.scheme = "https"
+	}
+
+	remote, ok := parseNodeAddr(r.RemoteAddr)
+	if !ok {
+		info.ip, _, _ = net.SplitHostPort(r.RemoteAddr)
+		return info
+	}
+	info.ip = remote.String()
+	if !isTrustedProxy(remote, proxies) {
+		return info
+	}
+
+	// Collect the chain of client addresses, closest proxy last
+	var chain []string
+	var hosts, protos []string
+	if forwarded := r.Header.Values("Forwarded"); len(forwarded) > 0 {
+		for _, e := range parseForwarded(forwarded) {
+			chain = append(chain, e.forNode)
+			hosts = append(hosts, e.host)
+			protos = append(protos, e.proto)
+		}
+	} else {
+		chain = headerList(r.Header.Values("X-Forwarded-For"))
+		// Each proxy appends its own host and proto, so the lists line up with
+		// the chain from the right; left-most values may be client supplied
+		hosts = alignHops(headerList(r.Header.Values("X-Forwarded-Host")), len(chain))
+		protos = alignHops(headerList(r.Header.Values("X-Forwarded-Proto")), len(chain))
+		for i := range protos {
+			protos[i] = strings.ToLower(protos[i])
+		}
+		if len(chain) == 0 {
+			// Without a chain only the values set by the trusted peer apply
+			if values := headerList(r.Header.Values("X-Forwarded-Host")); len(values) > 0 {
+				info.host = values[len(values)-1]
+			}
+			if values := headerList(r.Header.Values("X-Forwarded-Proto")); len(values) > 0 {
+				info.scheme = strings.ToLower(values[len(values)-1])
+			}
+		}
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseNodeAddr(chain[i])
+		if !ok {
+			// Obfuscated or malformed hops end the trusted chain
+			break
+		}
+		info.ip = addr.String()
+		if hosts != nil && hosts[i] != "" {
+			info.host = hosts[i]
+		}
+		if protos != nil && protos[i] != "" {
+			info.scheme = protos[i]
+		}
+		if !isTrustedProxy(addr, proxies) {
+			break
+		}
+	}
+	return info
+}
+
+// headerList splits comma-separated header values into trimmed items, in order
+func headerList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+	return items
+}
+
+// alignHops lines values up with the last n hops of a chain. Values beyond the
+// chain are dropped from the left and missing hops are empty.
+func alignHops(values []string, n int) []string {
+	aligned := make([]string, n)
+	for i, j := n-1, len(values)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		aligned[i] = values[j]
+	}
+	return aligned
+}
+
+// requestCookies returns the first value of each cookie sent with r
+func requestCookies(r *http.Request) map[string]string {
+	cookies := make(map[string]string)
+	for _, cookie := range r.Cookies() {
+		if _, ok := cookies[cookie.Name]; !ok {
+			cookies[cookie.Name] = cookie.Value
+		}
+	}
+	return cookies
+}
+
+// clientCertSubject returns the subject of the client certificate presented over TLS, if any
+func clientCertSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return r.TLS.PeerCertificates[0].Subject.String()
+}
@@ -0,0 +1,182 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Test basic request facts are extracted
+func TestExtractRequestInfo(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://api.example.com:8080/v1/items?x=1", strings.NewReader("{}"))
+	req.RemoteAddr = "198.51.100.7:51234"
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	req.AddCookie(&http.Cookie{Name: "session", Value: "shadowed"})
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+
+	data := extractRequest(t, Config{}, req)
+
+	if data.Method != "POST" || data.Scheme != "http" || data.Host != "api.example.com:8080" || data.Path != "/v1/items" {
+		t.Errorf("Unexpected request info: %s %s %s %s", data.Method, data.Scheme, data.Host, data.Path)
+	}
+	// Forwarding headers from untrusted peers are ignored
+	if data.RemoteIP != "198.51.100.7" {
+		t.Errorf("Expected peer address, got %s", data.RemoteIP)
+	}
+	if data.Cookies["session"] != "abc" {
+		t.Errorf("Expected first cookie value, got %v", data.Cookies)
+	}
+	if data.ClientCertSubject != "" {
+		t.Errorf("Expected no client certificate, got %s", data.ClientCertSubject)
+	}
+
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "client-1", Organization: []string{"Acme"}}}}}
+	data = extractRequest(t, Config{}, req)
+	if data.Scheme != "https" || data.ClientCertSubject != "CN=client-1,O=Acme" {
+		t.Errorf("Expected TLS info, got %s %s", data.Scheme, data.ClientCertSubject)
+	}
+}
+
+// Test client IP resolution through trusted proxies
+func TestResolveClientTrustedProxies(t *testing.T) {
+	proxies := []string{"10.0.0.0/8", "2001:db8::1"}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		ip         string
+		host       string
+		scheme     string
+	}{
+		{
+			name:       "x-forwarded-for skips trusted hops",
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1, 203.0.113.5, 10.1.2.3", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "shop.example.com"},
+			ip:         "203.0.113.5",
+			host:       "shop.example.com",
+			scheme:     "https",
+		},
+		{
+			name:       "forwarded takes precedence",
+			remoteAddr: "[2001:db8::1]:443",
+			headers:    map[string]string{"Forwarded": `for="[2001:db8::7]:4711";proto=https;host=a.example, for=10.0.0.9`, "X-Forwarded-For": "192.0.2.99"},
+			ip:         "2001:db8::7",
+			host:       "a.example",
+			scheme:     "https",
+		},
+		{
+			name:       "all hops trusted",
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "10.9.9.9"},
+			ip:         "10.9.9.9",
+			host:       "example.com",
+			scheme:     "http",
+		},
+		{
+			name:       "obfuscated hop ends the chain",
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"Forwarded": "for=192.0.2.1, for=_hidden, for=10.0.0.3"},
+			ip:         "10.0.0.3",
+			host:       "example.com",
+			scheme:     "http",
+		},
+		{
+			name:       "client-injected forwarded values are ignored",
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1, 203.0.113.5", "X-Forwarded-Host": "evil.example, shop.example.com", "X-Forwarded-Proto": "http, HTTPS"},
+			ip:         "203.0.113.5",
+			host:       "shop.example.com",
+			scheme:     "https",
+		},
+		{
+			name:       "client-injected host without chain entry",
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.5", "X-Forwarded-Host": "evil.example, shop.example.com", "X-Forwarded-Proto": "ftp, https"},
+			ip:         "203.0.113.5",
+			host:       "shop.example.com",
+			scheme:     "https",
+		},
+		{
+			name:       "trusted peer without chain",
+			remoteAddr: "10.0.0.2:443",
+			headers:    map[string]string{"X-Forwarded-Host": "evil.example, shop.example.com", "X-Forwarded-Proto": "https"},
+			ip:         "10.0.0.2",
+			host:       "shop.example.com",
+			scheme:     "https",
+		},
+		{
+			name:       "untrusted peer",
+			remoteAddr: "192.0.2.50:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Host": "evil.example"},
+			ip:         "192.0.2.50",
+			host:       "example.com",
+			scheme:     "http",
+		},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+
+		data := extractRequest(t, Config{TrustedProxies: proxies}, req)
+		if data.RemoteIP != tt.ip || data.Host != tt.host || data.Scheme != tt.scheme {
+			t.Errorf("%s: expected %s %s %s, got %s %s %s", tt.name, tt.ip, tt.host, tt.scheme, data.RemoteIP, data.Host, data.Scheme)
+		}
+	}
+
+	if _, err := NewParser(Config{TrustedProxies: []string{"not-an-ip"}}); err == nil {
+		t.Error("Expected error for invalid trusted proxy")
+	}
+}
+
+// Test RequestData can be serialized and templates use the new fields
+func TestRequestDataSerializable(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("info", `{{.Method}} {{.Path}} {{.Cookies.lang}} {{cookie .Request "lang"}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/orders", strings.NewReader(`1
+{"a":1}
+x`))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.AddCookie(&http.Cookie{Name: "lang", Value: "en"})
+
+	var buf bytes.Buffer
+	data, err := p.Parse("info", req, &buf)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "POST /orders en en" {
+		t.Errorf("Expected 'POST /orders en en', got '%s'", buf.String())
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Failed to serialize RequestData: %v", err)
+	}
+	var decoded RequestData
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to deserialize RequestData: %v", err)
+	}
+	if decoded.Method != "POST" || decoded.Path != "/orders" || decoded.Cookies["lang"] != "en" || len(decoded.BodyRecords) != 2 {
+		t.Errorf("Unexpected round trip: %s", encoded)
+	}
+	if !strings.Contains(string(encoded), `"RecordErrors":[{"Line":3,"Err":`) {
+		t.Errorf("Expected record errors to serialize, got %s", encoded)
+	}
+}
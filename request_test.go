@@ -0,0 +1,247 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newBodyRequest creates a POST request with body and contentType
+func newBodyRequest(contentType, body string) *http.Request {
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+// extractRequest extracts the data of req with a parser configured by config
+func extractRequest(t *testing.T, config Config, req *http.Request) *RequestData {
+	t.Helper()
+	p, err := NewParser(config)
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	data, err := p.Extract(req)
+	if err != nil {
+		t.Fatalf("Failed to extract request data: %v", err)
+	}
+	return data
+}
+
+// Test body size limit
+func TestRereadableRequestMaxBodyBytes(t *testing.T) {
+	options := ExtractOptions{MaxBodyBytes: 10}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("small"))
+	rereadable, err := NewRereadableRequestWithOptions(req, options)
+	if err != nil {
+		t.Fatalf("Expected body within limit to be accepted, got %v", err)
+	}
+	if rereadable.Body() != "small" {
+		t.Errorf("Expected 'small', got '%s'", rereadable.Body())
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != "small" {
+		t.Errorf("Expected request body to remain readable, got '%s'", body)
+	}
+
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader("this body is too large"))
+	if _, err := NewRereadableRequestWithOptions(req, options); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Expected ErrBodyTooLarge, got %v", err)
+	}
+
+	req, _ = http.NewRequest("POST", "http://example.com/", nil)
+	if _, err := NewRereadableRequestWithOptions(req, options, []byte("provided body too large")); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Expected ErrBodyTooLarge for provided body, got %v", err)
+	}
+}
+
+// Test oversized bodies spilled to disk still allow header and query extraction
+func TestRereadableRequestSpillBodyToDisk(t *testing.T) {
+	payload := strings.Repeat("x", 1000)
+	req, _ := http.NewRequest("POST", "http://example.com/upload?name=file", strings.NewReader(payload))
+	req.Header.Set("X-Upload", "yes")
+
+	rereadable, err := NewRereadableRequestWithOptions(req, ExtractOptions{MaxBodyBytes: 100, SpillBodyToDisk: true})
+	if err != nil {
+		t.Fatalf("Failed to create re-readable request: %v", err)
+	}
+	if !rereadable.Spilled() {
+		t.Fatal("Expected body to be spilled")
+	}
+
+	data, err := rereadable.Extract()
+	if err != nil {
+		t.Fatalf("Failed to extract request data: %v", err)
+	}
+	if !data.BodySpilled || data.Body != "" {
+		t.Errorf("Expected spilled body not to be loaded, got BodySpilled=%v len(Body)=%d", data.BodySpilled, len(data.Body))
+	}
+	if data.Query["name"][0] != "file" || data.Headers["X-Upload"][0] != "yes" {
+		t.Errorf("Expected query and headers to be extracted, got %v %v", data.Query, data.Headers)
+	}
+
+	// The full body stays readable from the temporary file
+	body, err := io.ReadAll(req.Body)
+	if err != nil || string(body) != payload {
+		t.Errorf("Expected spilled body to be readable, got %d bytes (%v)", len(body), err)
+	}
+
+	// Reading the request again keeps the spilled body
+	again, err := NewRereadableRequestWithOptions(req, ExtractOptions{MaxBodyBytes: 100, SpillBodyToDisk: true})
+	if err != nil || !again.Spilled() {
+		t.Errorf("Expected spilled body to be reused, got spilled=%v (%v)", again.Spilled(), err)
+	}
+
+	name := req.Body.(*spilledBody).Name()
+	req.Body.Close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary file to be removed on close, got %v", err)
+	}
+}
+
+// Test the parser removes spilled bodies when parsing ends and caps their size
+func TestParserSpilledBodyCleanup(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	p, err := NewParser(Config{MaxBodyBytes: 100, SpillBodyToDisk: true, MaxSpillBytes: 2000})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+	if err := p.UpdateTemplate("spill", "{{.Request.Method}} {{.BodySpilled}}"); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	assertEmpty := func() {
+		t.Helper()
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("Failed to read temp dir: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected temp dir to be empty, got %d entries", len(entries))
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(strings.Repeat("x", 1000)))
+	var buf bytes.Buffer
+	if _, err := p.Parse("spill", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "POST true" {
+		t.Errorf("Expected 'POST true', got '%s'", buf.String())
+	}
+	assertEmpty()
+
+	// Failed parses remove the file too
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader(strings.Repeat("x", 1000)))
+	if _, err := p.Parse("missing", req, &bytes.Buffer{}); err == nil {
+		t.Error("Expected error for missing template")
+	}
+	assertEmpty()
+
+	// Bodies above MaxSpillBytes are rejected
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader(strings.Repeat("x", 3000)))
+	if _, err := p.Parse("spill", req, &bytes.Buffer{}); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Expected ErrBodyTooLarge, got %v", err)
+	}
+	assertEmpty()
+}
+
+// Test parser threads body limits and multipart memory from Config
+func TestParserBodyLimits(t *testing.T) {
+	p, err := NewParser(Config{MaxBodyBytes: 4096, MultipartMaxMemory: 1024})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(strings.Repeat("x", 5000)))
+	if _, err := p.Extract(req); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Expected ErrBodyTooLarge, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("name", "value")
+	writer.Close()
+
+	req, _ = http.NewRequest("POST", "http://example.com/", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	data, err := p.Extract(req)
+	if err != nil {
+		t.Fatalf("Failed to extract multipart request: %v", err)
+	}
+	if data.Form["name"][0] != "value" {
+		t.Errorf("Expected form value 'value', got %v", data.Form["name"])
+	}
+}
+
+// Test top-level JSON arrays and scalars are exposed through BodyJSONValue
+func TestExtractJSONValue(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected interface{}
+		isObject bool
+	}{
+		{`{"id":1}`, map[string]interface{}{"id": float64(1)}, true},
+		{`[{"id":1},{"id":2}]`, []interface{}{map[string]interface{}{"id": float64(1)}, map[string]interface{}{"id": float64(2)}}, false},
+		{`"hello"`, "hello", false},
+		{`42`, float64(42), false},
+		{`true`, true, false},
+		{`null`, nil, false},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+
+		rereadable, err := NewRereadableRequest(req)
+		if err != nil {
+			t.Fatalf("Failed to create re-readable request: %v", err)
+		}
+		data, err := rereadable.Extract()
+		if err != nil {
+			t.Fatalf("Failed to extract request data: %v", err)
+		}
+
+		if !reflect.DeepEqual(data.BodyJSONValue, tt.expected) {
+			t.Errorf("%s: expected BodyJSONValue %v, got %v", tt.body, tt.expected, data.BodyJSONValue)
+		}
+		if (data.BodyJSON != nil) != tt.isObject {
+			t.Errorf("%s: expected BodyJSON set only for objects, got %v", tt.body, data.BodyJSON)
+		}
+	}
+}
+
+// Test templates can range over a JSON array body
+func TestParseJSONArrayBody(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("batch", `{{range .BodyJSONValue}}{{.id}};{{end}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(`[{"id":1},{"id":2}]`))
+	req.Header.Set("Content-Type", "application/json")
+
+	var buf bytes.Buffer
+	if _, err := p.Parse("batch", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "1;2;" {
+		t.Errorf("Expected '1;2;', got '%s'", buf.String())
+	}
+}
@@ -2,43 +2,106 @@ package parser
 
 import (
 	"container/list"
+	"errors"
+	"log/slog"
 	"sync"
 	"text/template"
+	"text/template/parse"
 	"time"
 )
 
 // CachedTemplate holds a compiled template with metadata
 type CachedTemplate struct {
-	Template     *template.Template
+	Template     Template // *text/template.Template or *html/template.Template
 	LastModified time.Time
 	AccessTime   time.Time
 	AccessCount  int64
 	Hash         string // Hash of the template content for change detection
+
+	// executor runs Template under a context
+	executor *templateExecutor
+
+	// source and loader are kept for templates stored with Compile, so they can
+	// serve as partials and be recompiled when one of their partials changes
+	source string
+	loader TemplateLoader
+	stored bool
+
+	// dependencies maps each template resolved for {{template}} calls to where
+	// and when it was resolved
+	dependencies map[string]dependency
 }
 
-// TemplateCache provides efficient caching of compiled templates
+// dependency records how a {{template}} reference was resolved
+type dependency struct {
+	modified time.Time // Zero if the reference was unresolved
+	stored   bool      // Resolved from a template stored with Compile
+}
+
+// TemplateCache provides efficient caching of compiled templates.
+// Templates referenced with {{template "name"}} that are not defined in the same
+// content are resolved from templates stored with Compile, then through the
+// loader, and associated into one template set. The cache tracks these
+// dependencies so that changing a partial recompiles every stored template that
+// includes it and invalidates every loaded one.
 type TemplateCache struct {
-	templates map[string]*CachedTemplate
-	lruList   *list.List
-	lruIndex  map[string]*list.Element
-	maxSize   int
-	funcMap   template.FuncMap
-	mu        sync.RWMutex
+	templates  map[string]*CachedTemplate
+	lruList    *list.List
+	lruIndex   map[string]*list.Element
+	dependents map[string]map[string]struct{} // dependency name -> names of cached templates using it
+	maxSize    int
+	funcMap    template.FuncMap
+	execFuncs  executionFuncs // Functions of funcMap bound to each execution
+	engine     Engine
+	htmlExts   []string
+	mu         sync.RWMutex
 }
 
 // NewTemplateCache creates a new template cache
 func NewTemplateCache(maxSize int, funcMap template.FuncMap) *TemplateCache {
 	return &TemplateCache{
-		templates: make(map[string]*CachedTemplate),
-		lruList:   list.New(),
-		lruIndex:  make(map[string]*list.Element),
-		maxSize:   maxSize,
-		funcMap:   funcMap,
+		templates:  make(map[string]*CachedTemplate),
+		lruList:    list.New(),
+		lruIndex:   make(map[string]*list.Element),
+		dependents: make(map[string]map[string]struct{}),
+		maxSize:    maxSize,
+		funcMap:    funcMap,
+	}
+}
+
+// SetEngine sets the default engine used to compile templates. Templates whose
+// name ends with one of htmlExtensions are always compiled with HTMLEngine.
+func (c *TemplateCache) SetEngine(engine Engine, htmlExtensions ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.engine = engine
+	c.htmlExts = htmlExtensions
+}
+
+// EngineFor returns the engine used to compile the named template
+func (c *TemplateCache) EngineFor(name string) Engine {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return selectEngine(name, c.engine, c.htmlExts)
+}
+
+// Get retrieves a template from the cache or compiles it if not found.
+// If loader is a SnapshotLoader, the template and its partials are checked
+// and compiled against a single snapshot.
+func (c *TemplateCache) Get(name string, loader TemplateLoader) (Template, error) {
+	executor, err := c.executor(name, loader)
+	if err != nil {
+		return nil, err
 	}
+	return executor.tmpl, nil
 }
 
-// Get retrieves a template from the cache or compiles it if not found
-func (c *TemplateCache) Get(name string, loader TemplateLoader) (*template.Template, error) {
+// executor returns the executor of a template like Get returns the template
+func (c *TemplateCache) executor(name string, loader TemplateLoader) (*templateExecutor, error) {
+	loader = snapshotOf(loader)
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -49,17 +112,18 @@ func (c *TemplateCache) Get(name string, loader TemplateLoader) (*template.Templ
 		if err != nil {
 			// If we can't get the modification time, use cached version
 			c.updateAccess(name, cached)
-			return cached.Template, nil
+			return cached.executor, nil
 		}
 
-		if lastMod.After(cached.LastModified) {
-			// Template has been modified, reload it
+		if lastMod.After(cached.LastModified) || c.dependenciesModified(cached, loader) {
+			// Template or one of its partials has been modified, reload it
+			c.invalidate(name)
 			return c.loadAndCache(name, loader)
 		}
 
 		// Template is up to date, update access time and return
 		c.updateAccess(name, cached)
-		return cached.Template, nil
+		return cached.executor, nil
 	}
 
 	// Template not in cache, load and cache it
@@ -67,7 +131,7 @@ func (c *TemplateCache) Get(name string, loader TemplateLoader) (*template.Templ
 }
 
 // loadAndCache loads a template and adds it to the cache
-func (c *TemplateCache) loadAndCache(name string, loader TemplateLoader) (*template.Template, error) {
+func (c *TemplateCache) loadAndCache(name string, loader TemplateLoader) (*templateExecutor, error) {
 	// Load template content
 	content, err := loader.Load(name)
 	if err != nil {
@@ -80,30 +144,28 @@ func (c *TemplateCache) loadAndCache(name string, loader TemplateLoader) (*templ
 		lastMod = time.Now()
 	}
 
-	// Compile template
-	tmpl := template.New(name)
-	if c.funcMap != nil {
-		tmpl = tmpl.Funcs(c.funcMap)
-	}
-
-	tmpl, err = tmpl.Parse(content)
+	// Compile template together with the partials and layouts it references
+	tmpl, dependencies, err := compileTemplate(selectEngine(name, c.engine, c.htmlExts), name, content, c.funcMap, loader, c.storedSource)
 	if err != nil {
 		return nil, err
 	}
+	executor := c.newExecutor(tmpl)
 
 	// Create cached template
 	cached := &CachedTemplate{
-		Template:     tmpl,
+		Template:     executor.tmpl,
+		executor:     executor,
 		LastModified: lastMod,
 		AccessTime:   time.Now(),
 		AccessCount:  1,
 		Hash:         "", // No hash available from loader
+		dependencies: dependencies,
 	}
 
 	// Add to cache
 	c.addToCache(name, cached)
 
-	return tmpl, nil
+	return executor, nil
 }
 
 // addToCache adds a template to the cache with LRU eviction
@@ -111,13 +173,14 @@ func (c *TemplateCache) addToCache(name string, cached *CachedTemplate) {
 	// Remove existing entry if it exists
 	if existing, exists := c.templates[name]; exists {
 		c.removeFromLRU(name)
-		_ = existing
+		c.unlinkDependencies(name, existing)
 	}
 
 	// Add new entry
 	c.templates[name] = cached
 	element := c.lruList.PushFront(name)
 	c.lruIndex[name] = element
+	c.linkDependencies(name, cached)
 
 	// Evict least recently used items if cache is full
 	if c.maxSize > 0 && len(c.templates) > c.maxSize {
@@ -156,37 +219,188 @@ func (c *TemplateCache) evictLRU() {
 		name := back.Value.(string)
 		c.lruList.Remove(back)
 		delete(c.lruIndex, name)
+		if cached, exists := c.templates[name]; exists {
+			c.unlinkDependencies(name, cached)
+		}
 		delete(c.templates, name)
 	}
 }
 
-// Remove removes a template from the cache
+// Remove removes a template from the cache. Stored templates that depend on it
+// are recompiled and loaded ones are removed as well.
 func (c *TemplateCache) Remove(name string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if _, exists := c.templates[name]; exists {
+	c.invalidate(name)
+}
+
+// invalidate removes a template and updates its dependents
+func (c *TemplateCache) invalidate(name string) {
+	if cached, exists := c.templates[name]; exists {
 		delete(c.templates, name)
 		c.removeFromLRU(name)
+		c.unlinkDependencies(name, cached)
+	}
+
+	c.updateDependents(name, map[string]bool{name: true})
+}
+
+// updateDependents recompiles the stored templates that depend on name from
+// their source, and removes the loaded ones so they are loaded again on their
+// next use. Both continue transitively with their own dependents.
+func (c *TemplateCache) updateDependents(name string, visited map[string]bool) {
+	dependents := make([]string, 0, len(c.dependents[name]))
+	for dependent := range c.dependents[name] {
+		dependents = append(dependents, dependent)
+	}
+
+	for _, dependent := range dependents {
+		if visited[dependent] {
+			continue
+		}
+		visited[dependent] = true
+
+		cached, exists := c.templates[dependent]
+		if !exists {
+			continue
+		}
+		if !cached.stored {
+			delete(c.templates, dependent)
+			c.removeFromLRU(dependent)
+			c.unlinkDependencies(dependent, cached)
+		} else if err := c.recompile(dependent, cached); err != nil {
+			// Keep serving the previous version
+			slog.Warn("Failed to recompile dependent template", "template", dependent, "partial", name, "error", err)
+		}
+		c.updateDependents(dependent, visited)
+	}
+
+	if len(c.dependents[name]) == 0 {
+		delete(c.dependents, name)
+	}
+}
+
+// recompile compiles a stored template again from its source
+func (c *TemplateCache) recompile(name string, cached *CachedTemplate) error {
+	tmpl, dependencies, err := compileTemplate(selectEngine(name, c.engine, c.htmlExts), name, cached.source, c.funcMap, snapshotOf(cached.loader), c.storedSource)
+	if err != nil {
+		return err
+	}
+	executor := c.newExecutor(tmpl)
+
+	c.unlinkDependencies(name, cached)
+	cached.Template = executor.tmpl
+	cached.executor = executor
+	cached.LastModified = time.Now()
+	cached.dependencies = dependencies
+	c.linkDependencies(name, cached)
+	return nil
+}
+
+// storedSource returns the source of a template stored with Compile
+func (c *TemplateCache) storedSource(name string) (string, time.Time, bool) {
+	cached, exists := c.templates[name]
+	if !exists || !cached.stored {
+		return "", time.Time{}, false
+	}
+	return cached.source, cached.LastModified, true
+}
+
+// linkDependencies records the edges from a template's dependencies to the template
+func (c *TemplateCache) linkDependencies(name string, cached *CachedTemplate) {
+	for dependency := range cached.dependencies {
+		if c.dependents[dependency] == nil {
+			c.dependents[dependency] = make(map[string]struct{})
+		}
+		c.dependents[dependency][name] = struct{}{}
+	}
+}
+
+// unlinkDependencies removes the edges recorded by linkDependencies
+func (c *TemplateCache) unlinkDependencies(name string, cached *CachedTemplate) {
+	for dependency := range cached.dependencies {
+		delete(c.dependents[dependency], name)
+		if len(c.dependents[dependency]) == 0 {
+			delete(c.dependents, dependency)
+		}
+	}
+}
+
+// dependenciesModified reports whether any partial of a cached template changed
+func (c *TemplateCache) dependenciesModified(cached *CachedTemplate, loader TemplateLoader) bool {
+	for name, dependency := range cached.dependencies {
+		if dependency.stored {
+			// Stored partials update their dependents when they change
+			continue
+		}
+		loadedAt := dependency.modified
+		lastMod, err := loader.LastModified(name)
+		if loadedAt.IsZero() {
+			// The reference was unresolved, reload once the loader provides it
+			if err == nil {
+				return true
+			}
+			continue
+		}
+		if errors.Is(err, ErrTemplateNotFound) {
+			return true
+		}
+		if err == nil && lastMod.After(loadedAt) {
+			return true
+		}
 	}
+	return false
 }
 
-// Set directly sets a template in the cache with the given hash
-func (c *TemplateCache) Set(name string, tmpl *template.Template, hash string) {
+// Set directly sets a template in the cache with the given hash.
+// Stored templates that depend on name are recompiled and loaded ones invalidated.
+func (c *TemplateCache) Set(name string, tmpl Template, hash string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Create cached template
-	cached := &CachedTemplate{
-		Template:     tmpl,
-		LastModified: time.Now(),
-		AccessTime:   time.Now(),
-		AccessCount:  1,
-		Hash:         hash,
+	c.set(name, &CachedTemplate{Template: tmpl, Hash: hash, executor: c.newExecutor(tmpl)})
+}
+
+// Compile compiles content as the named template with the engine selected for
+// name, resolving referenced templates from stored templates and through loader,
+// which may be nil, and stores it with the given hash. The source is kept so that the template can
+// be used as a partial and is recompiled when one of its partials changes.
+func (c *TemplateCache) Compile(name, content, hash string, loader TemplateLoader) (Template, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tmpl, dependencies, err := compileTemplate(selectEngine(name, c.engine, c.htmlExts), name, content, c.funcMap, snapshotOf(loader), c.storedSource)
+	if err != nil {
+		return nil, err
 	}
+	executor := c.newExecutor(tmpl)
+
+	c.set(name, &CachedTemplate{
+		Template:     executor.tmpl,
+		executor:     executor,
+		Hash:         hash,
+		source:       content,
+		loader:       loader,
+		stored:       true,
+		dependencies: dependencies,
+	})
+	return executor.tmpl, nil
+}
+
+// newExecutor creates the executor of a template compiled with the cache's functions
+func (c *TemplateCache) newExecutor(tmpl Template) *templateExecutor {
+	return newTemplateExecutor(tmpl, c.funcMap, c.execFuncs)
+}
+
+// set stores a template and updates the cached templates that depend on it
+func (c *TemplateCache) set(name string, cached *CachedTemplate) {
+	cached.LastModified = time.Now()
+	cached.AccessTime = time.Now()
+	cached.AccessCount = 1
 
-	// Add to cache
 	c.addToCache(name, cached)
+	c.updateDependents(name, map[string]bool{name: true})
 }
 
 // Clear clears all templates from the cache
@@ -197,6 +411,7 @@ func (c *TemplateCache) Clear() {
 	c.templates = make(map[string]*CachedTemplate)
 	c.lruList = list.New()
 	c.lruIndex = make(map[string]*list.Element)
+	c.dependents = make(map[string]map[string]struct{})
 }
 
 // GetHash returns the hash of a cached template, or empty string if not found
@@ -228,6 +443,132 @@ func (c *TemplateCache) Stats() CacheStats {
 	return stats
 }
 
+// storedLookup returns the source and modification time of a stored template
+type storedLookup func(name string) (content string, modified time.Time, ok bool)
+
+// compileTemplate parses content with the given engine and resolves the templates it references
+func compileTemplate(engine Engine, name, content string, funcMap template.FuncMap, loader TemplateLoader, stored storedLookup) (Template, map[string]dependency, error) {
+	set, err := parseTemplateSet(engine, name, content, funcMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Resolve partials and layouts referenced from other templates
+	dependencies, err := resolveDependencies(set, loader, stored)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return set.template(), dependencies, nil
+}
+
+// resolveDependencies parses every template referenced in set that is not
+// defined in it into the same set, taking stored templates first and then the
+// loader. It returns how each referenced template was resolved.
+func resolveDependencies(set templateSet, loader TemplateLoader, stored storedLookup) (map[string]dependency, error) {
+	dependencies := make(map[string]dependency)
+
+	for {
+		missing := undefinedReferences(set.trees())
+		if len(missing) == 0 {
+			return dependencies, nil
+		}
+
+		resolved := false
+		for _, name := range missing {
+			if _, seen := dependencies[name]; seen {
+				continue
+			}
+
+			if content, lastMod, ok := stored(name); ok {
+				if err := set.add(name, content); err != nil {
+					return nil, err
+				}
+				dependencies[name] = dependency{modified: lastMod, stored: true}
+				resolved = true
+				continue
+			}
+
+			// Without a loader only stored templates resolve
+			if loader == nil {
+				dependencies[name] = dependency{}
+				continue
+			}
+
+			content, err := loader.Load(name)
+			if errors.Is(err, ErrTemplateNotFound) {
+				// Leave the reference unresolved; execution reports it
+				slog.Debug("Referenced template not found", "template", set.template().Name(), "reference", name)
+				dependencies[name] = dependency{}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			lastMod, err := loader.LastModified(name)
+			if err != nil {
+				lastMod = time.Now()
+			}
+
+			if err := set.add(name, content); err != nil {
+				return nil, err
+			}
+			dependencies[name] = dependency{modified: lastMod}
+			resolved = true
+		}
+
+		if !resolved {
+			return dependencies, nil
+		}
+	}
+}
+
+// undefinedReferences returns the names used in {{template}} actions that are not
+// defined by any of the given parse trees
+func undefinedReferences(trees []*parse.Tree) []string {
+	defined := make(map[string]bool)
+	for _, tree := range trees {
+		defined[tree.Name] = true
+	}
+
+	seen := make(map[string]bool)
+	var missing []string
+	for _, tree := range trees {
+		collectTemplateReferences(tree.Root, func(name string) {
+			if !defined[name] && !seen[name] {
+				seen[name] = true
+				missing = append(missing, name)
+			}
+		})
+	}
+	return missing
+}
+
+// collectTemplateReferences walks a parse tree and reports every {{template}} name
+func collectTemplateReferences(node parse.Node, report func(name string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateReferences(child, report)
+		}
+	case *parse.TemplateNode:
+		report(n.Name)
+	case *parse.IfNode:
+		collectTemplateReferences(n.List, report)
+		collectTemplateReferences(n.ElseList, report)
+	case *parse.RangeNode:
+		collectTemplateReferences(n.List, report)
+		collectTemplateReferences(n.ElseList, report)
+	case *parse.WithNode:
+		collectTemplateReferences(n.List, report)
+		collectTemplateReferences(n.ElseList, report)
+	}
+}
+
 // CacheStats holds cache statistics
 type CacheStats struct {
 	Size     int   // Current number of cached templates
@@ -0,0 +1,214 @@
+package parser
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// Test cross-template {{template}} resolution through the loader
+func TestTemplateCacheComposition(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layout.tmpl":  {Data: []byte(`<{{template "header" .}}|{{template "content" .}}>`)},
+		"header.tmpl":  {Data: []byte(`H:{{.}}`)},
+		"page.tmpl":    {Data: []byte(`{{define "content"}}C:{{.}}{{end}}{{template "layout" .}}`)},
+		"nested.tmpl":  {Data: []byte(`{{if .}}{{range .}}{{template "header" .}}{{end}}{{end}}`)},
+		"missing.tmpl": {Data: []byte(`{{template "nowhere" .}}`)},
+	}
+	loader := NewFSLoader(fsys, ".tmpl")
+	cache := NewTemplateCache(10, nil)
+
+	tmpl, err := cache.Get("page", loader)
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "x"); err != nil {
+		t.Fatalf("Failed to execute template: %v", err)
+	}
+	if buf.String() != "<H:x|C:x>" {
+		t.Errorf("Expected '<H:x|C:x>', got '%s'", buf.String())
+	}
+
+	tmpl, err = cache.Get("nested", loader)
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+	buf.Reset()
+	if err := tmpl.Execute(&buf, []string{"a", "b"}); err != nil {
+		t.Fatalf("Failed to execute template: %v", err)
+	}
+	if buf.String() != "H:aH:b" {
+		t.Errorf("Expected 'H:aH:b', got '%s'", buf.String())
+	}
+
+	// Unknown references compile and fail at execution time as before
+	tmpl, err = cache.Get("missing", loader)
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, nil); err == nil {
+		t.Error("Expected execution error for undefined template")
+	}
+}
+
+// Test compiling without a loader resolves only stored templates
+func TestTemplateCacheCompileNilLoader(t *testing.T) {
+	cache := NewTemplateCache(10, nil)
+
+	tmpl, err := cache.Compile("a", `{{template "b"}}`, "h1", nil)
+	if err != nil {
+		t.Fatalf("Failed to compile template: %v", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, nil); err == nil {
+		t.Error("Expected execution error for undefined template")
+	}
+
+	if _, err := cache.Compile("b", `B`, "h2", nil); err != nil {
+		t.Fatalf("Failed to compile template: %v", err)
+	}
+	tmpl, err = cache.Compile("c", `<{{template "b"}}>`, "h3", nil)
+	if err != nil {
+		t.Fatalf("Failed to compile template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatalf("Failed to execute template: %v", err)
+	}
+	if buf.String() != "<B>" {
+		t.Errorf("Expected '<B>', got '%s'", buf.String())
+	}
+}
+
+// Test changing a partial invalidates every dependent template
+func TestTemplateCachePartialInvalidation(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"header.tmpl": {Data: []byte(`v1`), ModTime: created},
+		"page.tmpl":   {Data: []byte(`[{{template "header"}}]`), ModTime: created},
+		"outer.tmpl":  {Data: []byte(`({{template "page"}})`), ModTime: created},
+	}
+	loader := NewFSLoader(fsys, ".tmpl")
+	cache := NewTemplateCache(10, nil)
+
+	render := func(name string) string {
+		tmpl, err := cache.Get(name, loader)
+		if err != nil {
+			t.Fatalf("Failed to get template: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatalf("Failed to execute template: %v", err)
+		}
+		return buf.String()
+	}
+
+	if got := render("outer"); got != "([v1])" {
+		t.Errorf("Expected '([v1])', got '%s'", got)
+	}
+	if got := render("page"); got != "[v1]" {
+		t.Errorf("Expected '[v1]', got '%s'", got)
+	}
+
+	// A modified partial is picked up on the next Get
+	fsys["header.tmpl"] = &fstest.MapFile{Data: []byte(`v2`), ModTime: created.Add(time.Hour)}
+	if got := render("outer"); got != "([v2])" {
+		t.Errorf("Expected '([v2])' after partial change, got '%s'", got)
+	}
+
+	// Removing a partial from the cache invalidates its dependents transitively
+	render("header")
+	if cache.Stats().Size != 3 {
+		t.Fatalf("Expected 3 cached templates, got %d", cache.Stats().Size)
+	}
+	cache.Remove("header")
+	if size := cache.Stats().Size; size != 0 {
+		t.Errorf("Expected all dependents to be invalidated, got cache size %d", size)
+	}
+}
+
+// Test UpdateTemplate resolves partials and recompiles dependents
+func TestUpdateTemplateComposition(t *testing.T) {
+	loader := NewMemoryLoader()
+	loader.AddTemplate("footer", "-- {{.Request.Method}}")
+
+	p, err := NewParser(Config{TemplateLoader: loader})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.UpdateTemplate("mail", `Hi {{template "footer" .}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	var buf bytes.Buffer
+	if _, err := p.Parse("mail", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "Hi -- GET" {
+		t.Errorf("Expected 'Hi -- GET', got '%s'", buf.String())
+	}
+
+	// Updating the partial recompiles the cached template that includes it
+	if err := p.UpdateTemplate("footer", "-- bye"); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if size := p.GetCacheStats().Size; size != 2 {
+		t.Errorf("Expected both templates to remain cached, got size %d", size)
+	}
+	buf.Reset()
+	if _, err := p.Parse("mail", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "Hi -- bye" {
+		t.Errorf("Expected 'Hi -- bye', got '%s'", buf.String())
+	}
+}
+
+// Test partials pushed with UpdateTemplate are resolved from the cache
+func TestUpdateTemplateCachedPartials(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	render := func(name string) string {
+		var buf bytes.Buffer
+		if _, err := p.Parse(name, req, &buf); err != nil {
+			t.Fatalf("Failed to parse template %s: %v", name, err)
+		}
+		return buf.String()
+	}
+
+	// The partial does not exist yet when the template is compiled
+	if err := p.UpdateTemplate("mail", `Hi {{template "footer" .}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if err := p.UpdateTemplate("footer", `-- {{template "signature" .}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if err := p.UpdateTemplate("signature", "Ada"); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if got := render("mail"); got != "Hi -- Ada" {
+		t.Errorf("Expected 'Hi -- Ada', got '%s'", got)
+	}
+
+	// Changes propagate through nested partials
+	if err := p.UpdateTemplate("signature", "Grace"); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if got := render("mail"); got != "Hi -- Grace" {
+		t.Errorf("Expected 'Hi -- Grace', got '%s'", got)
+	}
+	if got := render("footer"); got != "-- Grace" {
+		t.Errorf("Expected '-- Grace', got '%s'", got)
+	}
+}
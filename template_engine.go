@@ -0,0 +1,140 @@
+package parser
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Engine selects the template package used to compile templates
+type Engine int
+
+const (
+	// TextEngine compiles templates with text/template (no escaping)
+	TextEngine Engine = iota
+
+	// HTMLEngine compiles templates with html/template, which applies
+	// contextual auto-escaping to all values inserted into the output
+	HTMLEngine
+)
+
+// String returns the name of the engine
+func (e Engine) String() string {
+	switch e {
+	case HTMLEngine:
+		return "html"
+	default:
+		return "text"
+	}
+}
+
+// Template is a compiled template of either engine.
+// Both *text/template.Template and *html/template.Template implement it.
+type Template interface {
+	// Name returns the name of the template
+	Name() string
+
+	// Execute applies the template to data and writes the output to wr
+	Execute(wr io.Writer, data interface{}) error
+
+	// ExecuteTemplate applies the associated template with the given name to data
+	ExecuteTemplate(wr io.Writer, name string, data interface{}) error
+}
+
+// templateSet adapts an engine's template set for dependency resolution
+type templateSet interface {
+	// trees returns the parse trees of every template defined in the set
+	trees() []*parse.Tree
+
+	// add parses content as a new template associated with the set
+	add(name, content string) error
+
+	// template returns the root template of the set
+	template() Template
+}
+
+// textSet is the text/template implementation of templateSet
+type textSet struct {
+	root *template.Template
+}
+
+func (s textSet) trees() []*parse.Tree {
+	var trees []*parse.Tree
+	for _, t := range s.root.Templates() {
+		if t.Tree != nil {
+			trees = append(trees, t.Tree)
+		}
+	}
+	return trees
+}
+
+func (s textSet) add(name, content string) error {
+	_, err := s.root.New(name).Parse(content)
+	return err
+}
+
+func (s textSet) template() Template {
+	return s.root
+}
+
+// htmlSet is the html/template implementation of templateSet
+type htmlSet struct {
+	root *htmltemplate.Template
+}
+
+func (s htmlSet) trees() []*parse.Tree {
+	var trees []*parse.Tree
+	for _, t := range s.root.Templates() {
+		if t.Tree != nil {
+			trees = append(trees, t.Tree)
+		}
+	}
+	return trees
+}
+
+func (s htmlSet) add(name, content string) error {
+	_, err := s.root.New(name).Parse(content)
+	return err
+}
+
+func (s htmlSet) template() Template {
+	return s.root
+}
+
+// parseTemplateSet parses content as the root template of a new set for the engine
+func parseTemplateSet(engine Engine, name, content string, funcMap template.FuncMap) (templateSet, error) {
+	if engine == HTMLEngine {
+		tmpl := htmltemplate.New(name)
+		if funcMap != nil {
+			tmpl = tmpl.Funcs(htmltemplate.FuncMap(funcMap))
+		}
+		tmpl, err := tmpl.Parse(content)
+		if err != nil {
+			return nil, err
+		}
+		return htmlSet{root: tmpl}, nil
+	}
+
+	tmpl := template.New(name)
+	if funcMap != nil {
+		tmpl = tmpl.Funcs(funcMap)
+	}
+	tmpl, err := tmpl.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	return textSet{root: tmpl}, nil
+}
+
+// selectEngine returns the engine for a template name: HTMLEngine if the name ends
+// with one of htmlExtensions, otherwise the default engine
+func selectEngine(name string, defaultEngine Engine, htmlExtensions []string) Engine {
+	for _, ext := range htmlExtensions {
+		if ext != "" && strings.HasSuffix(name, ext) {
+			return HTMLEngine
+		}
+	}
+	return defaultEngine
+}
@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"net/http"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// Test html/template engine escapes request data
+func TestParserHTMLEngine(t *testing.T) {
+	loader := NewMemoryLoader()
+	loader.AddTemplate("page", `<p title="{{index .Query "q" 0}}">{{.Body}}</p>`)
+
+	p, err := NewParser(Config{TemplateLoader: loader, Engine: HTMLEngine})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	req, _ := http.NewRequest("POST", `http://example.com/?q="onmouseover=x`, strings.NewReader("<script>alert(1)</script>"))
+	req.Header.Set("Content-Type", "text/plain")
+
+	var buf bytes.Buffer
+	if _, err := p.Parse("page", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	expected := `<p title="&#34;onmouseover=x">&lt;script&gt;alert(1)&lt;/script&gt;</p>`
+	if buf.String() != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, buf.String())
+	}
+}
+
+// Test engine selection by template name extension
+func TestParserHTMLExtensions(t *testing.T) {
+	loader := NewMemoryLoader()
+	loader.AddTemplate("mail.html", `<b>{{.Body}}</b>`)
+	loader.AddTemplate("mail.txt", `<b>{{.Body}}</b>`)
+
+	p, err := NewParser(Config{TemplateLoader: loader, HTMLExtensions: []string{".html"}})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	tests := map[string]string{
+		"mail.html": "<b>a &amp; b</b>",
+		"mail.txt":  "<b>a & b</b>",
+	}
+	for name, expected := range tests {
+		req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("a & b"))
+		var buf bytes.Buffer
+		if _, err := p.Parse(name, req, &buf); err != nil {
+			t.Fatalf("Failed to parse %s: %v", name, err)
+		}
+		if buf.String() != expected {
+			t.Errorf("%s: expected '%s', got '%s'", name, expected, buf.String())
+		}
+	}
+
+	if err := p.UpdateTemplate("inline.html", `{{.Body}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("<i>"))
+	var buf bytes.Buffer
+	if _, err := p.Parse("inline.html", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "&lt;i&gt;" {
+		t.Errorf("Expected '&lt;i&gt;', got '%s'", buf.String())
+	}
+}
+
+// Test cached templates expose the concrete engine type and compose partials
+func TestTemplateCacheEngines(t *testing.T) {
+	loader := NewMemoryLoader()
+	loader.AddTemplate("page.html", `<div>{{template "partial.html" .}}</div>`)
+	loader.AddTemplate("partial.html", `{{.}}`)
+	loader.AddTemplate("plain", `{{.}}`)
+
+	cache := NewTemplateCache(10, DefaultFuncMap())
+	cache.SetEngine(TextEngine, ".html")
+
+	tmpl, err := cache.Get("page.html", loader)
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+	if _, ok := tmpl.(*htmltemplate.Template); !ok {
+		t.Errorf("Expected *html/template.Template, got %T", tmpl)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "<x>"); err != nil {
+		t.Fatalf("Failed to execute template: %v", err)
+	}
+	if buf.String() != "<div>&lt;x&gt;</div>" {
+		t.Errorf("Expected '<div>&lt;x&gt;</div>', got '%s'", buf.String())
+	}
+
+	tmpl, err = cache.Get("plain", loader)
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+	if _, ok := tmpl.(*template.Template); !ok {
+		t.Errorf("Expected *text/template.Template, got %T", tmpl)
+	}
+}
+
+// Test DefaultFuncMap works with the html/template engine
+func TestDefaultFuncMapHTMLEngine(t *testing.T) {
+	p, err := NewParser(Config{Engine: HTMLEngine})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{upper "a"}}{{lower "B"}}{{trim " c "}}{{replace "d" "d" "D"}}{{join (split "e,f" ",") "-"}}{{substr "ghi" 1 1}}{{default "j" ""}}{{header .Request "X-K"}}`
+	if err := p.UpdateTemplate("funcs", content); err != nil {
+		t.Fatalf("Failed to compile template with DefaultFuncMap: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-K", "k")
+	var buf bytes.Buffer
+	if _, err := p.Parse("funcs", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "AbcDe-fhjk" {
+		t.Errorf("Expected 'AbcDe-fhjk', got '%s'", buf.String())
+	}
+}
@@ -22,6 +22,23 @@ type TemplateLoader interface {
 	LastModified(name string) (time.Time, error)
 }
 
+// SnapshotLoader is implemented by loaders whose templates change together,
+// such as versioned bundles. Snapshot returns a loader pinned to the current
+// version; the template cache compiles a template and all its partials
+// against one snapshot.
+type SnapshotLoader interface {
+	TemplateLoader
+	Snapshot() TemplateLoader
+}
+
+// snapshotOf returns a snapshot of loader if it supports one, otherwise loader
+func snapshotOf(loader TemplateLoader) TemplateLoader {
+	if s, ok := loader.(SnapshotLoader); ok {
+		return s.Snapshot()
+	}
+	return loader
+}
+
 // MemoryLoader loads templates from memory (useful for testing)
 type MemoryLoader struct {
 	templates map[string]string
@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"github.com/BurntSushi/toml"
+)
+
+// tomlMediaTypes are the media types decoded as TOML by default
+var tomlMediaTypes = []string{
+	"application/toml",
+	"text/toml",
+	"text/x-toml",
+}
+
+// TOMLDecoder is the built-in decoder for TOML media types. Tables are decoded
+// as map[string]interface{}; the result is also exposed as RequestData.BodyTOML.
+type TOMLDecoder struct{}
+
+// Decode implements BodyDecoder
+func (TOMLDecoder) Decode(body []byte, contentType string) (interface{}, error) {
+	var value map[string]interface{}
+	if err := toml.Unmarshal(body, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// isTOMLContentType reports whether contentType is a TOML media type
+func isTOMLContentType(contentType string) bool {
+	mt := mediaType(contentType)
+	for _, ct := range tomlMediaTypes {
+		if mt == ct {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Test TOML bodies are decoded into BodyTOML and usable from templates
+func TestExtractTOMLBody(t *testing.T) {
+	body := `
+title = "deploy"
+
+[database]
+host = "db.internal"
+ports = [5432, 5433]
+`
+	data := extractRequest(t, Config{}, newBodyRequest("application/toml", body))
+	if data.BodyTOML["title"] != "deploy" {
+		t.Errorf("Expected title 'deploy', got %v", data.BodyTOML)
+	}
+	database, ok := data.BodyTOML["database"].(map[string]interface{})
+	if !ok || database["host"] != "db.internal" {
+		t.Errorf("Expected database table, got %v", data.BodyTOML["database"])
+	}
+
+	if data := extractRequest(t, Config{}, newBodyRequest("application/toml", `title = `)); data.BodyTOML != nil {
+		t.Errorf("Expected invalid TOML to be ignored, got %v", data.BodyTOML)
+	}
+
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+	if err := p.UpdateTemplate("toml", `{{.BodyTOML.database.host}}:{{index .BodyTOML.database.ports 0}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/toml")
+	var buf bytes.Buffer
+	if _, err := p.Parse("toml", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "db.internal:5432" {
+		t.Errorf("Expected 'db.internal:5432', got '%s'", buf.String())
+	}
+}
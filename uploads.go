@@ -0,0 +1,221 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+)
+
+// DefaultMaxFileReadBytes is the default limit for reading uploaded file
+// contents from templates with fileText and fileBase64
+const DefaultMaxFileReadBytes = 1 << 20 // 1 MB
+
+// UploadedFile describes a file part of a multipart/form-data request
+type UploadedFile struct {
+	// Field is the form field name of the part
+	Field string
+
+	// Filename is the file name sent by the client
+	Filename string
+
+	// Size is the file size in bytes
+	Size int64
+
+	// ContentType is the Content-Type of the part
+	ContentType string
+
+	// SHA256 is the hex-encoded SHA-256 digest of the file contents
+	SHA256 string
+
+	// Parsed contains the file contents decoded by the BodyDecoder for its
+	// Content-Type, e.g. for JSON or XML parts
+	Parsed interface{}
+
+	header *multipart.FileHeader
+}
+
+// Open opens the uploaded file for reading
+func (f *UploadedFile) Open() (multipart.File, error) {
+	if f.header == nil {
+		return nil, errors.New("uploaded file contents are not available")
+	}
+	return f.header.Open()
+}
+
+// readAll reads the file contents, failing with ErrOutputTooLarge above limit
+func (f *UploadedFile) readAll(limit int64) ([]byte, error) {
+	if f == nil {
+		return nil, errors.New("no uploaded file")
+	}
+	if limit > 0 && f.Size > limit {
+		return nil, fmt.Errorf("%w: file %s is %d bytes (limit %d bytes)", ErrOutputTooLarge, f.Filename, f.Size, limit)
+	}
+	file, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// extractFiles describes the file parts of a parsed multipart form. Parts with
+// a Content-Type that has a BodyDecoder and fit in maxMemory are decoded.
+func extractFiles(form *multipart.Form, options ExtractOptions, maxMemory int64) (map[string][]*UploadedFile, error) {
+	if form == nil || len(form.File) == 0 {
+		return nil, nil
+	}
+
+	files := make(map[string][]*UploadedFile, len(form.File))
+	for field, headers := range form.File {
+		for _, header := range headers {
+			file := &UploadedFile{
+				Field:       field,
+				Filename:    header.Filename,
+				Size:        header.Size,
+				ContentType: header.Header.Get("Content-Type"),
+				header:      header,
+			}
+
+			content, err := describeFile(file, maxMemory)
+			if err != nil {
+				return nil, err
+			}
+			if content != nil {
+				file.Parsed = decodePart(content, file.ContentType, options)
+			}
+
+			files[field] = append(files[field], file)
+		}
+	}
+	return files, nil
+}
+
+// describeFile computes the digest of file and returns its contents if it is
+// small enough to be decoded
+func describeFile(file *UploadedFile, maxMemory int64) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	var content bytes.Buffer
+	var w io.Writer = hash
+	if file.Size <= maxMemory {
+		w = io.MultiWriter(hash, &content)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return nil, err
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if file.Size > maxMemory {
+		return nil, nil
+	}
+	return content.Bytes(), nil
+}
+
+// extractFormParts decodes the non-file parts of a multipart body that were sent
+// with a Content-Type that has a BodyDecoder, such as a JSON metadata part
+func extractFormParts(body []byte, contentType string, options ExtractOptions, maxMemory int64) map[string]interface{} {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		return nil
+	}
+
+	var parsed map[string]interface{}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				slog.Debug("Failed to read multipart part", "error", err)
+			}
+			return parsed
+		}
+
+		partType := part.Header.Get("Content-Type")
+		if part.FormName() == "" || part.FileName() != "" || partType == "" {
+			continue
+		}
+
+		content, err := io.ReadAll(io.LimitReader(part, maxMemory+1))
+		if err != nil || int64(len(content)) > maxMemory {
+			continue
+		}
+		if value := decodePart(content, partType, options); value != nil {
+			if parsed == nil {
+				parsed = make(map[string]interface{})
+			}
+			parsed[part.FormName()] = value
+		}
+	}
+}
+
+// decodePart decodes content with the BodyDecoder for contentType, logging failures
+func decodePart(content []byte, contentType string, options ExtractOptions) interface{} {
+	decoder := findBodyDecoder(contentType, options)
+	if decoder == nil || len(content) == 0 {
+		return nil
+	}
+
+	// Like request bodies, parts with an unknown charset are only decoded when
+	// their format is UTF-8 by definition
+	content, _, err := decodeCharset(content, contentType)
+	if err != nil {
+		slog.Warn("Failed to decode part charset", "error", err, "content_type", contentType)
+		if !isUTF8ContentType(contentType) {
+			return nil
+		}
+	}
+
+	value, err := decoder.Decode(content, contentType)
+	if err != nil {
+		slog.Warn("Failed to decode multipart part", "error", err, "content_type", contentType)
+		return nil
+	}
+	return value
+}
+
+// fileReadLimit returns the read limit for template file functions
+func fileReadLimit(maxBytes int64) int64 {
+	if maxBytes > 0 && maxBytes < DefaultMaxFileReadBytes {
+		return maxBytes
+	}
+	return DefaultMaxFileReadBytes
+}
+
+// fileText returns a template function that reads an uploaded file as text
+func fileText(maxBytes int64) func(*UploadedFile) (string, error) {
+	limit := fileReadLimit(maxBytes)
+	return func(f *UploadedFile) (string, error) {
+		content, err := f.readAll(limit)
+		return string(content), err
+	}
+}
+
+// fileBase64 returns a template function that reads an uploaded file as base64
+func fileBase64(maxBytes int64) func(*UploadedFile) (string, error) {
+	limit := fileReadLimit(maxBytes)
+	return func(f *UploadedFile) (string, error) {
+		if f == nil {
+			return "", errors.New("no uploaded file")
+		}
+		if encoded := int64(base64.StdEncoding.EncodedLen(int(f.Size))); maxBytes > 0 && encoded > maxBytes {
+			return "", fmt.Errorf("%w: encoded file %s is %d bytes (limit %d bytes)", ErrOutputTooLarge, f.Filename, encoded, maxBytes)
+		}
+		content, err := f.readAll(limit)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(content), nil
+	}
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func newUploadRequest(t *testing.T) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("title", "report")
+
+	part, _ := writer.CreateFormFile("doc", "notes.txt")
+	part.Write([]byte("hello upload"))
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="config"; filename="config.json"`)
+	header.Set("Content-Type", "application/json")
+	part, _ = writer.CreatePart(header)
+	part.Write([]byte(`{"retries":3}`))
+
+	header = textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="meta"`)
+	header.Set("Content-Type", "application/xml")
+	part, _ = writer.CreatePart(header)
+	part.Write([]byte(`<meta><owner>ops</owner></meta>`))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "http://example.com/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// Test uploaded files are described in RequestData.Files
+func TestExtractFiles(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	data, err := p.Extract(newUploadRequest(t))
+	if err != nil {
+		t.Fatalf("Failed to extract request data: %v", err)
+	}
+
+	if len(data.Files["doc"]) != 1 {
+		t.Fatalf("Expected one doc file, got %v", data.Files)
+	}
+	doc := data.Files["doc"][0]
+	sum := sha256.Sum256([]byte("hello upload"))
+	if doc.Filename != "notes.txt" || doc.Size != 12 || doc.Field != "doc" || doc.ContentType != "application/octet-stream" {
+		t.Errorf("Unexpected file description: %+v", doc)
+	}
+	if doc.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected digest %x, got %s", sum, doc.SHA256)
+	}
+	if doc.Parsed != nil {
+		t.Errorf("Expected plain file not to be parsed, got %v", doc.Parsed)
+	}
+
+	// Structured file parts are decoded
+	config, ok := data.Files["config"][0].Parsed.(map[string]interface{})
+	if !ok || config["retries"] != float64(3) {
+		t.Errorf("Expected parsed JSON file, got %v", data.Files["config"][0].Parsed)
+	}
+
+	// Structured value parts are decoded and their text kept in Form
+	if _, ok := data.FormParsed["meta"].(map[string]interface{}); !ok {
+		t.Errorf("Expected parsed XML part, got %v", data.FormParsed)
+	}
+	if data.Form["title"][0] != "report" || !strings.Contains(data.Form["meta"][0], "<owner>") {
+		t.Errorf("Expected form values, got %v", data.Form)
+	}
+}
+
+// Test templates can read uploaded files
+func TestParseFileFuncs(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{with index .Files.doc 0}}{{.Filename}} {{fileText .}} {{fileBase64 .}}{{end}} {{(index .Files.config 0).Parsed.retries}} {{.FormParsed.meta.meta.owner.owner}}`
+	if err := p.UpdateTemplate("upload", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := p.Parse("upload", newUploadRequest(t), &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	expected := "notes.txt hello upload aGVsbG8gdXBsb2Fk 3 ops"
+	if buf.String() != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, buf.String())
+	}
+
+	// Reading is capped by the output limit
+	funcMap := DefaultFuncMapWithLimit(8)
+	readText := funcMap["fileText"].(func(*UploadedFile) (string, error))
+	data, err := p.Extract(newUploadRequest(t))
+	if err != nil {
+		t.Fatalf("Failed to extract request data: %v", err)
+	}
+	if _, err := readText(data.Files["doc"][0]); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	if _, err := readText(nil); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+// Test parts with an unknown charset are decoded like request bodies
+func TestDecodePartUnknownCharset(t *testing.T) {
+	if value := decodePart([]byte("<a>1</a>"), "application/xml; charset=x-unknown", ExtractOptions{}); value != nil {
+		t.Errorf("Expected XML part in unknown charset not to be decoded, got %v", value)
+	}
+
+	value, ok := decodePart([]byte(`{"a":1}`), "application/json; charset=utf8mb4", ExtractOptions{}).(map[string]interface{})
+	if !ok || value["a"] != float64(1) {
+		t.Errorf("Expected JSON part to be decoded as received, got %v", value)
+	}
+}
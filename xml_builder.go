@@ -0,0 +1,339 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SOAP envelope namespaces
+const (
+	SOAP11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	SOAP12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// XMLRenderOptions controls how RenderXML maps values to elements
+type XMLRenderOptions struct {
+	// Root is the name of the root element (default "root")
+	Root string
+
+	// ArrayItem wraps array items in elements of this name inside a single
+	// element named after the key. By default every item repeats the element
+	// named after the key. Arrays at the root always use item elements
+	// (default "item")
+	ArrayItem string
+
+	// AttrPrefix marks map keys that are rendered as attributes of the enclosing
+	// element, e.g. "@id" (default "@")
+	AttrPrefix string
+
+	// TextKey is the map key rendered as the text of the enclosing element
+	// (default "#text")
+	TextKey string
+
+	// Indent indents nested elements by this string per level (default none)
+	Indent string
+}
+
+// withDefaults returns the options with defaults applied
+func (o XMLRenderOptions) withDefaults() XMLRenderOptions {
+	if o.Root == "" {
+		o.Root = "root"
+	}
+	if o.AttrPrefix == "" {
+		o.AttrPrefix = "@"
+	}
+	if o.TextKey == "" {
+		o.TextKey = "#text"
+	}
+	return o
+}
+
+// RenderXML renders a value such as RequestData.BodyJSON as an XML element.
+// Maps become child elements in key order, arrays repeat elements and other
+// values become escaped text. Element names must be valid XML names.
+func RenderXML(value interface{}, options XMLRenderOptions) (string, error) {
+	options = options.withDefaults()
+	r := xmlRenderer{options: options}
+
+	v := reflect.ValueOf(value)
+	if isXMLArray(v) {
+		// Arrays at the root are wrapped in item elements
+		item := options.ArrayItem
+		if item == "" {
+			item = "item"
+		}
+		r.options.ArrayItem = item
+		if err := r.writeArray(options.Root, v, 0); err != nil {
+			return "", err
+		}
+		return r.sb.String(), nil
+	}
+
+	if err := r.writeElement(options.Root, value, 0); err != nil {
+		return "", err
+	}
+	return r.sb.String(), nil
+}
+
+// xmlRenderer writes values as XML
+type xmlRenderer struct {
+	options XMLRenderOptions
+	sb      strings.Builder
+}
+
+// isXMLArray reports whether v is a slice or array other than a byte slice
+func isXMLArray(v reflect.Value) bool {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+// newline starts a new indented line at depth, if indentation is enabled
+func (r *xmlRenderer) newline(depth int) {
+	if r.options.Indent != "" {
+		r.sb.WriteString("\n" + strings.Repeat(r.options.Indent, depth))
+	}
+}
+
+// writeElement writes value as the element name
+func (r *xmlRenderer) writeElement(name string, value interface{}, depth int) error {
+	if !isXMLName(name) {
+		return fmt.Errorf("invalid XML element name %q", name)
+	}
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			r.sb.WriteString("<" + name + "/>")
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		r.sb.WriteString("<" + name + "/>")
+		return nil
+	}
+	if v.Kind() != reflect.Map {
+		r.sb.WriteString("<" + name + ">" + escapeXMLText(xmlScalar(v.Interface())) + "</" + name + ">")
+		return nil
+	}
+
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	for iter := v.MapRange(); iter.Next(); {
+		entries = append(entries, entry{fmt.Sprint(iter.Key().Interface()), iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	r.sb.WriteString("<" + name)
+	var text string
+	var children []entry
+	for _, e := range entries {
+		switch {
+		case e.key == r.options.TextKey:
+			text = xmlScalar(e.value.Interface())
+		case strings.HasPrefix(e.key, r.options.AttrPrefix):
+			attr := strings.TrimPrefix(e.key, r.options.AttrPrefix)
+			if !isXMLName(attr) {
+				return fmt.Errorf("invalid XML attribute name %q", attr)
+			}
+			r.sb.WriteString(" " + attr + `="` + escapeXMLAttr(xmlScalar(e.value.Interface())) + `"`)
+		default:
+			children = append(children, e)
+		}
+	}
+
+	if text == "" && len(children) == 0 {
+		r.sb.WriteString("/>")
+		return nil
+	}
+	r.sb.WriteString(">" + escapeXMLText(text))
+	for _, child := range children {
+		if isXMLArray(child.value) {
+			if err := r.writeChildArray(child.key, child.value, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		r.newline(depth + 1)
+		if err := r.writeElement(child.key, child.value.Interface(), depth+1); err != nil {
+			return err
+		}
+	}
+	if len(children) > 0 {
+		r.newline(depth)
+	}
+	r.sb.WriteString("</" + name + ">")
+	return nil
+}
+
+// writeChildArray writes the items of an array found under key
+func (r *xmlRenderer) writeChildArray(key string, v reflect.Value, depth int) error {
+	if r.options.ArrayItem != "" {
+		r.newline(depth)
+		return r.writeArray(key, v, depth)
+	}
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	for i := 0; i < v.Len(); i++ {
+		r.newline(depth)
+		if err := r.writeElement(key, v.Index(i).Interface(), depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArray writes the element name containing an ArrayItem element per item
+func (r *xmlRenderer) writeArray(name string, v reflect.Value, depth int) error {
+	if !isXMLName(name) {
+		return fmt.Errorf("invalid XML element name %q", name)
+	}
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Len() == 0 {
+		r.sb.WriteString("<" + name + "/>")
+		return nil
+	}
+
+	r.sb.WriteString("<" + name + ">")
+	for i := 0; i < v.Len(); i++ {
+		r.newline(depth + 1)
+		item := v.Index(i)
+		var err error
+		if isXMLArray(item) {
+			err = r.writeArray(r.options.ArrayItem, item, depth+1)
+		} else {
+			err = r.writeElement(r.options.ArrayItem, item.Interface(), depth+1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	r.newline(depth)
+	r.sb.WriteString("</" + name + ">")
+	return nil
+}
+
+// xmlScalar formats a value as text
+func xmlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// isXMLName reports whether name is a valid XML name
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if unicode.IsLetter(c) || c == '_' || c == ':' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(c) || c == '-' || c == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// validXMLChars replaces characters that XML 1.0 does not allow with U+FFFD
+func validXMLChars(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '\t' || c == '\n' || c == '\r' ||
+			(c >= 0x20 && c <= 0xD7FF) || (c >= 0xE000 && c <= 0xFFFD) || (c >= 0x10000 && c <= 0x10FFFF) {
+			return c
+		}
+		return unicode.ReplacementChar
+	}, s)
+}
+
+// escapeXMLText escapes a value for use as element content
+func escapeXMLText(s string) string {
+	return xmlTextEscaper.Replace(validXMLChars(s))
+}
+
+// escapeXMLAttr escapes a value for use in a double-quoted attribute
+func escapeXMLAttr(s string) string {
+	return xmlAttrEscaper.Replace(validXMLChars(s))
+}
+
+// SOAPEnvelope wraps body, and header if it is not empty, in a SOAP envelope.
+// version is "1.1" or "1.2"; header and body must already be XML.
+func SOAPEnvelope(version, body, header string) (string, error) {
+	var namespace string
+	switch version {
+	case "1.1", "":
+		namespace = SOAP11Namespace
+	case "1.2":
+		namespace = SOAP12Namespace
+	default:
+		return "", fmt.Errorf("unsupported SOAP version %q", version)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<soap:Envelope xmlns:soap="` + namespace + `">`)
+	if header != "" {
+		sb.WriteString("<soap:Header>" + header + "</soap:Header>")
+	}
+	sb.WriteString("<soap:Body>" + body + "</soap:Body></soap:Envelope>")
+	return sb.String(), nil
+}
+
+// xmlRender is the template function for RenderXML. Options are given as
+// "item=name", "attr=prefix", "text=key" and "indent=string" arguments
+func xmlRender(value interface{}, root string, options ...string) (string, error) {
+	renderOptions := XMLRenderOptions{Root: root}
+	for _, option := range options {
+		key, val, ok := strings.Cut(option, "=")
+		if !ok {
+			return "", fmt.Errorf("invalid xmlRender option %q", option)
+		}
+		switch key {
+		case "item":
+			renderOptions.ArrayItem = val
+		case "attr":
+			renderOptions.AttrPrefix = val
+		case "text":
+			renderOptions.TextKey = val
+		case "indent":
+			renderOptions.Indent = val
+		default:
+			return "", fmt.Errorf("unknown xmlRender option %q", key)
+		}
+	}
+	return RenderXML(value, renderOptions)
+}
+
+// soapEnvelope is the template function for SOAPEnvelope with an optional header
+func soapEnvelope(version, body string, header ...string) (string, error) {
+	return SOAPEnvelope(version, body, strings.Join(header, ""))
+}
@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Test rendering maps and arrays as XML
+func TestRenderXML(t *testing.T) {
+	value := map[string]interface{}{
+		"@id":   json.Number("42"),
+		"name":  "Fish & Chips <large>",
+		"price": 9.5,
+		"paid":  true,
+		"note":  nil,
+		"tags":  []interface{}{"hot", "salty"},
+		"customer": map[string]interface{}{
+			"#text": "Ada",
+			"@vip":  "yes \"really\"",
+		},
+	}
+
+	got, err := RenderXML(value, XMLRenderOptions{Root: "order"})
+	if err != nil {
+		t.Fatalf("Failed to render XML: %v", err)
+	}
+	expected := `<order id="42"><customer vip="yes &quot;really&quot;">Ada</customer><name>Fish &amp; Chips &lt;large&gt;</name>` +
+		`<note/><paid>true</paid><price>9.5</price><tags>hot</tags><tags>salty</tags></order>`
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	// Array items, attribute prefix and indentation
+	value = map[string]interface{}{
+		"-currency": "EUR",
+		"lines":     []interface{}{map[string]interface{}{"sku": "A1"}, "B2"},
+	}
+	got, err = RenderXML(value, XMLRenderOptions{Root: "order", ArrayItem: "line", AttrPrefix: "-", Indent: "  "})
+	if err != nil {
+		t.Fatalf("Failed to render XML: %v", err)
+	}
+	expected = "<order currency=\"EUR\">\n  <lines>\n    <line>\n      <sku>A1</sku>\n    </line>\n    <line>B2</line>\n  </lines>\n</order>"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	// Arrays at the root use item elements
+	got, err = RenderXML([]string{"a", "b"}, XMLRenderOptions{})
+	if err != nil || got != "<root><item>a</item><item>b</item></root>" {
+		t.Errorf("Unexpected root array rendering %q (%v)", got, err)
+	}
+
+	// Invalid names fail
+	if _, err := RenderXML(map[string]interface{}{"first name": "Ada"}, XMLRenderOptions{}); err == nil {
+		t.Error("Expected error for invalid element name")
+	}
+	if _, err := RenderXML("x", XMLRenderOptions{Root: "1st"}); err == nil {
+		t.Error("Expected error for invalid root name")
+	}
+}
+
+// Test escaping text and attributes
+func TestXMLEscape(t *testing.T) {
+	if got := escapeXMLText("a < b && c > d\n\x00"); got != "a &lt; b &amp;&amp; c &gt; d\n�" {
+		t.Errorf("Unexpected text escaping %q", got)
+	}
+	if got := escapeXMLAttr("say \"hi\"\tnow"); got != "say &quot;hi&quot;&#x9;now" {
+		t.Errorf("Unexpected attribute escaping %q", got)
+	}
+}
+
+// Test SOAP envelopes
+func TestSOAPEnvelope(t *testing.T) {
+	got, err := SOAPEnvelope("1.1", "<m:Ping/>", "")
+	if err != nil {
+		t.Fatalf("Failed to build envelope: %v", err)
+	}
+	if got != `<soap:Envelope xmlns:soap="`+SOAP11Namespace+`"><soap:Body><m:Ping/></soap:Body></soap:Envelope>` {
+		t.Errorf("Unexpected SOAP 1.1 envelope %s", got)
+	}
+
+	got, err = SOAPEnvelope("1.2", "<b/>", "<h/>")
+	if err != nil {
+		t.Fatalf("Failed to build envelope: %v", err)
+	}
+	if got != `<soap:Envelope xmlns:soap="`+SOAP12Namespace+`"><soap:Header><h/></soap:Header><soap:Body><b/></soap:Body></soap:Envelope>` {
+		t.Errorf("Unexpected SOAP 1.2 envelope %s", got)
+	}
+
+	if _, err := SOAPEnvelope("2.0", "", ""); err == nil {
+		t.Error("Expected error for unsupported SOAP version")
+	}
+
+	// The envelope parses back with namespaces
+	doc, err := parseXMLDocument(got, false)
+	if err != nil || doc.Root().Name.Space != SOAP12Namespace {
+		t.Errorf("Expected a well-formed SOAP 1.2 envelope, got %v (%v)", doc, err)
+	}
+}
+
+// Test turning a JSON request into a SOAP call with a template
+func TestParseJSONToSOAP(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{$payload := xmlRender .BodyJSON.order "m:GetPrice" "item=Item"}}` +
+		`{{soapEnvelope "1.1" $payload (printf "<m:Token>%s</m:Token>" (xmlEscape (header .Request "X-Token")))}}`
+	if err := p.UpdateTemplate("soap", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	body := `{"order":{"@xmlns:m":"urn:prices","sku":["A&B","C"]}}`
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Token", "<secret>")
+	var buf bytes.Buffer
+	if _, err := p.Parse("soap", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	expected := `<soap:Envelope xmlns:soap="` + SOAP11Namespace + `"><soap:Header><m:Token>&lt;secret&gt;</m:Token></soap:Header>` +
+		`<soap:Body><m:GetPrice xmlns:m="urn:prices"><sku><Item>A&amp;B</Item><Item>C</Item></sku></m:GetPrice></soap:Body></soap:Envelope>`
+	if buf.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, buf.String())
+	}
+
+	// Unknown options fail the template
+	if err := p.UpdateTemplate("bad", `{{xmlRender .BodyJSON "r" "color=red"}}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := p.Parse("bad", req, &bytes.Buffer{}); err == nil {
+		t.Error("Expected unknown xmlRender option to fail")
+	}
+}
@@ -0,0 +1,318 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// XMLConvention names a mapping between XML documents and JSON values
+type XMLConvention string
+
+const (
+	// XMLConventionGData maps attributes to "@name" keys and text to "#text".
+	// Elements with neither attributes nor children become plain strings
+	XMLConventionGData XMLConvention = "gdata"
+
+	// XMLConventionBadgerFish maps attributes to "@name" keys, text to "$" and
+	// namespace declarations to an "@xmlns" object whose "$" key is the default
+	// namespace. Every element becomes an object
+	XMLConventionBadgerFish XMLConvention = "badgerfish"
+
+	// XMLConventionParker drops the root element, attributes and namespace
+	// declarations. Text-only elements become strings, numbers or booleans,
+	// empty elements null, and elements whose children all share one name arrays
+	XMLConventionParker XMLConvention = "parker"
+)
+
+// XMLConvertOptions controls conversions between XML and JSON values
+type XMLConvertOptions struct {
+	// Convention is the mapping to use (default XMLConventionGData)
+	Convention XMLConvention
+
+	// ForceArray lists element paths that always become arrays, even when the
+	// element occurs once. A path is a list of names from the root element, e.g.
+	// "order/item"; a single name such as "item" matches at any depth. Names use
+	// the prefixes declared in the document, e.g. "soap:Body"
+	ForceArray []string
+
+	// Root is the root element name for ToXML when the value does not name a
+	// single root element, and always for the Parker convention (default "root")
+	Root string
+}
+
+// convention returns the validated convention of the options
+func (o XMLConvertOptions) convention() (XMLConvention, error) {
+	switch convention := XMLConvention(strings.ToLower(string(o.Convention))); convention {
+	case "":
+		return XMLConventionGData, nil
+	case XMLConventionGData, XMLConventionBadgerFish, XMLConventionParker:
+		return convention, nil
+	}
+	return "", fmt.Errorf("unsupported XML convention %q", o.Convention)
+}
+
+// FromXML parses XML content and converts it to a JSON value. The content must
+// be UTF-8; a declaration of any other encoding is an error
+func FromXML(xmlContent string, options XMLConvertOptions) (interface{}, error) {
+	doc, err := parseXMLDocument(xmlContent, false)
+	if err != nil {
+		return nil, err
+	}
+	return doc.ToValue(options)
+}
+
+// ToValue converts the document or element n to a JSON value
+func (n *XMLNode) ToValue(options XMLConvertOptions) (interface{}, error) {
+	convention, err := options.convention()
+	if err != nil || n == nil {
+		return nil, err
+	}
+	root := n
+	if n.Type == DocumentNode {
+		root = n.Root()
+	}
+	if root == nil || root.Type != ElementNode {
+		return nil, fmt.Errorf("cannot convert %s node", n.Type)
+	}
+
+	c := xmlConverter{convention: convention, forceArray: options.ForceArray}
+	name := root.qualifiedName(root.Name, false)
+	value := c.element(root, name)
+	if convention == XMLConventionParker {
+		return value, nil
+	}
+	return map[string]interface{}{name: value}, nil
+}
+
+// xmlConverter converts elements to JSON values
+type xmlConverter struct {
+	convention XMLConvention
+	forceArray []string
+}
+
+// forced reports whether the element at path must become an array
+func (c xmlConverter) forced(path string) bool {
+	for _, p := range c.forceArray {
+		if p == path || (!strings.Contains(p, "/") && strings.HasSuffix(path, "/"+p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// element converts n found at path
+func (c xmlConverter) element(n *XMLNode, path string) interface{} {
+	var sb strings.Builder
+	for _, child := range n.Children {
+		if child.Type == TextNode || child.Type == CDATANode {
+			sb.WriteString(child.Data)
+		}
+	}
+	text := strings.TrimSpace(sb.String())
+
+	switch c.convention {
+	case XMLConventionParker:
+		elements := n.Elements()
+		if len(elements) == 0 {
+			return parkerScalar(text)
+		}
+		name := elements[0].qualifiedName(elements[0].Name, false)
+		if len(elements) > 1 || c.forced(path+"/"+name) {
+			// Lists of like-named children become arrays, as does a single
+			// child whose path is forced, so one item looks like many
+			list := make([]interface{}, 0, len(elements))
+			for _, child := range elements {
+				if child.qualifiedName(child.Name, false) != name {
+					list = nil
+					break
+				}
+				list = append(list, c.element(child, path+"/"+name))
+			}
+			if list != nil {
+				return list
+			}
+		}
+		obj := make(map[string]interface{})
+		c.children(n, path, obj)
+		return obj
+
+	case XMLConventionBadgerFish:
+		obj := make(map[string]interface{})
+		var namespaces map[string]interface{}
+		for _, attr := range n.Attr {
+			if attr.isNamespaceDecl() {
+				if namespaces == nil {
+					namespaces = make(map[string]interface{})
+				}
+				prefix := "$"
+				if attr.Name.Space == "xmlns" {
+					prefix = attr.Name.Local
+				}
+				namespaces[prefix] = attr.Data
+				continue
+			}
+			obj["@"+n.qualifiedName(attr.Name, true)] = attr.Data
+		}
+		if namespaces != nil {
+			obj["@xmlns"] = namespaces
+		}
+		if text != "" {
+			obj["$"] = text
+		}
+		c.children(n, path, obj)
+		return obj
+
+	default:
+		obj := make(map[string]interface{})
+		for _, attr := range n.Attr {
+			name := n.qualifiedName(attr.Name, true)
+			if attr.Name.Space == "xmlns" {
+				name = "xmlns:" + attr.Name.Local
+			}
+			obj["@"+name] = attr.Data
+		}
+		c.children(n, path, obj)
+		if len(obj) == 0 {
+			return text
+		}
+		if text != "" {
+			obj["#text"] = text
+		}
+		return obj
+	}
+}
+
+// children adds the child elements of n to obj, collecting repeated and forced
+// elements into arrays
+func (c xmlConverter) children(n *XMLNode, path string, obj map[string]interface{}) {
+	var names []string
+	groups := make(map[string][]interface{})
+	for _, child := range n.Elements() {
+		name := child.qualifiedName(child.Name, false)
+		if _, exists := groups[name]; !exists {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], c.element(child, path+"/"+name))
+	}
+	for _, name := range names {
+		if values := groups[name]; len(values) > 1 || c.forced(path+"/"+name) {
+			obj[name] = values
+		} else {
+			obj[name] = values[0]
+		}
+	}
+}
+
+// parkerScalar converts element text to a boolean, number, string or null
+func parkerScalar(text string) interface{} {
+	switch text {
+	case "":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if (text[0] == '-' || isDigit(text[0])) && json.Valid([]byte(text)) {
+		return json.Number(text)
+	}
+	return text
+}
+
+// ToXML converts a JSON value to XML using the convention of options. For
+// GData and BadgerFish a map with a single element key names the root element
+func ToXML(value interface{}, options XMLConvertOptions) (string, error) {
+	convention, err := options.convention()
+	if err != nil {
+		return "", err
+	}
+
+	render := XMLRenderOptions{Root: options.Root, AttrPrefix: "@", TextKey: "#text"}
+	if convention == XMLConventionBadgerFish {
+		render.TextKey = "$"
+		value = expandBadgerFishNamespaces(value)
+	}
+
+	if m, ok := value.(map[string]interface{}); ok && len(m) == 1 && convention != XMLConventionParker {
+		for name, content := range m {
+			if !strings.HasPrefix(name, "@") && name != render.TextKey && !isXMLArray(reflect.ValueOf(content)) {
+				render.Root, value = name, content
+			}
+		}
+	}
+	return RenderXML(value, render)
+}
+
+// expandBadgerFishNamespaces replaces "@xmlns" objects with xmlns attributes
+func expandBadgerFishNamespaces(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			namespaces, ok := item.(map[string]interface{})
+			if key != "@xmlns" || !ok {
+				expanded[key] = expandBadgerFishNamespaces(item)
+				continue
+			}
+			for prefix, uri := range namespaces {
+				if prefix == "$" {
+					expanded["@xmlns"] = uri
+				} else {
+					expanded["@xmlns:"+prefix] = uri
+				}
+			}
+		}
+		return expanded
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded[i] = expandBadgerFishNamespaces(item)
+		}
+		return expanded
+	}
+	return value
+}
+
+// fromXML is the template function for FromXML. The source is XML text, a
+// node such as .XMLDoc, or the request data. The arguments are the convention
+// followed by force-array paths
+func fromXML(source interface{}, args ...string) (interface{}, error) {
+	var options XMLConvertOptions
+	if len(args) > 0 {
+		options.Convention = XMLConvention(args[0])
+		options.ForceArray = args[1:]
+	}
+
+	switch s := source.(type) {
+	case string:
+		return FromXML(s, options)
+	case *XMLNode:
+		return s.ToValue(options)
+	case *RequestData:
+		if s == nil || s.XMLDoc == nil {
+			return nil, nil
+		}
+		return s.XMLDoc.ToValue(options)
+	}
+	return nil, fmt.Errorf("fromXML: unsupported source %T", source)
+}
+
+// toXML is the template function for ToXML with an optional convention and root name
+func toXML(value interface{}, args ...string) (string, error) {
+	var options XMLConvertOptions
+	if len(args) > 0 {
+		options.Convention = XMLConvention(args[0])
+	}
+	if len(args) > 1 {
+		options.Root = args[1]
+	}
+	return ToXML(value, options)
+}
+
+// toJSON is the template function that encodes a value as JSON
+func toJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
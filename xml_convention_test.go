@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const conventionDocument = `<order xmlns:m="urn:meta" id="7" m:src="web">
+	<item sku="A1">Pen</item>
+	<total>12.50</total>
+	<paid>true</paid>
+	<note/>
+	<lines><line>1</line><line>2</line></lines>
+</order>`
+
+// toJSONString encodes a value for comparisons
+func toJSONString(t *testing.T, value interface{}) string {
+	t.Helper()
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to encode JSON: %v", err)
+	}
+	return string(encoded)
+}
+
+// Test converting XML with each convention
+func TestFromXMLConventions(t *testing.T) {
+	tests := []struct {
+		convention XMLConvention
+		expected   string
+	}{
+		{"", `{"order":{"@id":"7","@m:src":"web","@xmlns:m":"urn:meta","item":{"#text":"Pen","@sku":"A1"},"lines":{"line":["1","2"]},"note":"","paid":"true","total":"12.50"}}`},
+		{XMLConventionBadgerFish, `{"order":{"@id":"7","@m:src":"web","@xmlns":{"m":"urn:meta"},"item":{"$":"Pen","@sku":"A1"},"lines":{"line":[{"$":"1"},{"$":"2"}]},"note":{},"paid":{"$":"true"},"total":{"$":"12.50"}}}`},
+		{XMLConventionParker, `{"item":"Pen","lines":[1,2],"note":null,"paid":true,"total":12.50}`},
+	}
+	for _, tt := range tests {
+		value, err := FromXML(conventionDocument, XMLConvertOptions{Convention: tt.convention})
+		if err != nil {
+			t.Fatalf("Failed to convert XML with %q: %v", tt.convention, err)
+		}
+		if got := toJSONString(t, value); got != tt.expected {
+			t.Errorf("Convention %q: expected %s, got %s", tt.convention, tt.expected, got)
+		}
+	}
+
+	if _, err := FromXML(conventionDocument, XMLConvertOptions{Convention: "jsonml"}); err == nil {
+		t.Error("Expected error for unsupported convention")
+	}
+}
+
+// Test force-array paths keep single elements in arrays
+func TestFromXMLForceArray(t *testing.T) {
+	single := `<order><item>A</item><box><item>B</item></box></order>`
+
+	value, err := FromXML(single, XMLConvertOptions{ForceArray: []string{"order/item"}})
+	if err != nil {
+		t.Fatalf("Failed to convert XML: %v", err)
+	}
+	if got := toJSONString(t, value); got != `{"order":{"box":{"item":"B"},"item":["A"]}}` {
+		t.Errorf("Unexpected conversion %s", got)
+	}
+
+	value, _ = FromXML(single, XMLConvertOptions{Convention: XMLConventionParker, ForceArray: []string{"item"}})
+	if got := toJSONString(t, value); got != `{"box":["B"],"item":["A"]}` {
+		t.Errorf("Unexpected conversion %s", got)
+	}
+}
+
+// Test Parker force-array paths give one item the same shape as several
+func TestFromXMLParkerForceArraySingle(t *testing.T) {
+	options := XMLConvertOptions{Convention: XMLConventionParker, ForceArray: []string{"item"}}
+	for document, expected := range map[string]string{
+		`<order><items><item>1</item></items></order>`:               `{"items":[1]}`,
+		`<order><items><item>1</item><item>2</item></items></order>`: `{"items":[1,2]}`,
+		`<order><items><item>1</item><note>x</note></items></order>`: `{"items":{"item":[1],"note":"x"}}`,
+		`<order><items><entry>1</entry></items></order>`:             `{"items":{"entry":1}}`,
+	} {
+		value, err := FromXML(document, options)
+		if err != nil {
+			t.Fatalf("Failed to convert XML: %v", err)
+		}
+		if got := toJSONString(t, value); got != expected {
+			t.Errorf("%s: expected %s, got %s", document, expected, got)
+		}
+	}
+}
+
+// Test converting JSON values to XML and back
+func TestToXMLRoundTrip(t *testing.T) {
+	for _, convention := range []XMLConvention{XMLConventionGData, XMLConventionBadgerFish} {
+		value, err := FromXML(conventionDocument, XMLConvertOptions{Convention: convention})
+		if err != nil {
+			t.Fatalf("Failed to convert XML: %v", err)
+		}
+		xmlText, err := ToXML(value, XMLConvertOptions{Convention: convention})
+		if err != nil {
+			t.Fatalf("Failed to convert %s value to XML: %v", convention, err)
+		}
+		again, err := FromXML(xmlText, XMLConvertOptions{Convention: convention})
+		if err != nil {
+			t.Fatalf("Failed to parse generated XML %s: %v", xmlText, err)
+		}
+		if !reflect.DeepEqual(value, again) {
+			t.Errorf("Convention %s did not round trip:\n%v\n%v", convention, value, again)
+		}
+	}
+
+	got, err := ToXML(map[string]interface{}{"total": 12.5, "lines": []interface{}{1, 2}}, XMLConvertOptions{Convention: XMLConventionParker, Root: "order"})
+	if err != nil {
+		t.Fatalf("Failed to convert value to XML: %v", err)
+	}
+	if got != "<order><lines>1</lines><lines>2</lines><total>12.5</total></order>" {
+		t.Errorf("Unexpected Parker XML %s", got)
+	}
+}
+
+// Test the conversion template functions
+func TestParseXMLConversions(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{toJSON (fromXML . "parker" "items/item")}}|{{toXML (fromXML .XMLDoc "badgerfish") "badgerfish"}}|{{toXML (fromXML "<a>1</a>" "parker") "parker" "n"}}`
+	if err := p.UpdateTemplate("convert", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(`<items count="1"><item>5</item></items>`))
+	req.Header.Set("Content-Type", "application/xml")
+	var buf bytes.Buffer
+	if _, err := p.Parse("convert", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	expected := `[5]|<items count="1"><item>5</item></items>|<n>1</n>`
+	if buf.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, buf.String())
+	}
+}
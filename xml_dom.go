@@ -0,0 +1,353 @@
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// XMLNodeType identifies the kind of an XMLNode
+type XMLNodeType int
+
+const (
+	// DocumentNode is the root of a parsed document
+	DocumentNode XMLNodeType = iota
+	// ElementNode is an element
+	ElementNode
+	// AttributeNode is an attribute of an element
+	AttributeNode
+	// TextNode is character data
+	TextNode
+	// CDATANode is a CDATA section
+	CDATANode
+	// CommentNode is a comment
+	CommentNode
+	// ProcInstNode is a processing instruction, including the XML declaration
+	ProcInstNode
+	// DirectiveNode is a directive such as <!DOCTYPE ...>
+	DirectiveNode
+)
+
+// String returns the lower-case name of the node type, e.g. "element"
+func (t XMLNodeType) String() string {
+	switch t {
+	case DocumentNode:
+		return "document"
+	case ElementNode:
+		return "element"
+	case AttributeNode:
+		return "attribute"
+	case TextNode:
+		return "text"
+	case CDATANode:
+		return "cdata"
+	case CommentNode:
+		return "comment"
+	case ProcInstNode:
+		return "procinst"
+	case DirectiveNode:
+		return "directive"
+	}
+	return fmt.Sprintf("XMLNodeType(%d)", int(t))
+}
+
+// xmlNamespaceURI is the namespace bound to the reserved xml prefix
+const xmlNamespaceURI = "http://www.w3.org/XML/1998/namespace"
+
+// XMLNode is a node of an XML document tree. Unlike the maps of
+// RequestData.BodyXML it keeps namespaces, the order of children, comments,
+// processing instructions, CDATA sections and whitespace.
+type XMLNode struct {
+	// Type is the kind of node
+	Type XMLNodeType
+
+	// Name is the name of an element or attribute, or the target of a processing
+	// instruction; Name.Space is the namespace URI
+	Name xml.Name
+
+	// Data is the text of a text, CDATA or comment node, the value of an
+	// attribute, the instruction of a processing instruction or the directive
+	Data string
+
+	// Attr contains the attributes of an element, including namespace declarations
+	Attr []*XMLNode
+
+	// Children contains the child nodes in document order
+	Children []*XMLNode
+
+	// Parent is the parent node, or nil for the document
+	Parent *XMLNode `json:"-"`
+
+	// order is the position of the node in a preorder walk of its document,
+	// attributes following their element
+	order int
+}
+
+// String returns the XPath string value of the node: the concatenated text of
+// a document or element, and the data of other nodes
+func (n *XMLNode) String() string {
+	if n == nil {
+		return ""
+	}
+	switch n.Type {
+	case DocumentNode:
+		return n.Root().String()
+	case ElementNode:
+		var sb strings.Builder
+		n.writeText(&sb)
+		return sb.String()
+	default:
+		return n.Data
+	}
+}
+
+// writeText appends the text of all descendant text and CDATA nodes to sb
+func (n *XMLNode) writeText(sb *strings.Builder) {
+	for _, child := range n.Children {
+		switch child.Type {
+		case TextNode, CDATANode:
+			sb.WriteString(child.Data)
+		case ElementNode:
+			child.writeText(sb)
+		}
+	}
+}
+
+// Root returns the document element of the document n belongs to
+func (n *XMLNode) Root() *XMLNode {
+	if n == nil {
+		return nil
+	}
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	if n.Type != DocumentNode {
+		return n
+	}
+	for _, child := range n.Children {
+		if child.Type == ElementNode {
+			return child
+		}
+	}
+	return nil
+}
+
+// Elements returns the child elements of n in document order
+func (n *XMLNode) Elements() []*XMLNode {
+	if n == nil {
+		return nil
+	}
+	var elements []*XMLNode
+	for _, child := range n.Children {
+		if child.Type == ElementNode {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// Attribute returns the value of the attribute with the given local name, or ""
+func (n *XMLNode) Attribute(name string) string {
+	if n == nil {
+		return ""
+	}
+	for _, attr := range n.Attr {
+		if attr.Name.Local == name && !attr.isNamespaceDecl() {
+			return attr.Data
+		}
+	}
+	return ""
+}
+
+// isNamespaceDecl reports whether an attribute node declares a namespace
+func (n *XMLNode) isNamespaceDecl() bool {
+	return n.Type == AttributeNode && (n.Name.Space == "xmlns" || (n.Name.Space == "" && n.Name.Local == "xmlns"))
+}
+
+// OuterXML serializes n and its descendants. Namespace declarations of
+// ancestors that are in scope are added to the serialized element
+func (n *XMLNode) OuterXML() string {
+	if n == nil {
+		return ""
+	}
+	var sb strings.Builder
+	n.writeXML(&sb, true)
+	return sb.String()
+}
+
+// InnerXML serializes the children of n
+func (n *XMLNode) InnerXML() string {
+	if n == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, child := range n.Children {
+		child.writeXML(&sb, true)
+	}
+	return sb.String()
+}
+
+// xmlTextEscaper escapes character data
+var xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// xmlAttrEscaper escapes attribute values, keeping white space intact
+var xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;",
+	"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+// writeXML serializes n to sb. top is set for the node being serialized, whose
+// inherited namespace declarations must be repeated
+func (n *XMLNode) writeXML(sb *strings.Builder, top bool) {
+	switch n.Type {
+	case DocumentNode:
+		for _, child := range n.Children {
+			child.writeXML(sb, false)
+		}
+	case ElementNode:
+		name := n.qualifiedName(n.Name, false)
+		sb.WriteString("<" + name)
+		for _, attr := range n.Attr {
+			attr.writeXML(sb, false)
+		}
+		if top {
+			n.writeInheritedNamespaces(sb)
+		}
+		if len(n.Children) == 0 {
+			sb.WriteString("/>")
+			return
+		}
+		sb.WriteString(">")
+		for _, child := range n.Children {
+			child.writeXML(sb, false)
+		}
+		sb.WriteString("</" + name + ">")
+	case AttributeNode:
+		name := n.Name.Local
+		switch {
+		case n.Name.Space == "xmlns":
+			name = "xmlns:" + n.Name.Local
+		case n.Name.Space != "" && n.Parent != nil:
+			name = n.Parent.qualifiedName(n.Name, true)
+		}
+		sb.WriteString(" " + name + `="` + xmlAttrEscaper.Replace(n.Data) + `"`)
+	case TextNode:
+		sb.WriteString(xmlTextEscaper.Replace(n.Data))
+	case CDATANode:
+		sb.WriteString("<![CDATA[" + strings.ReplaceAll(n.Data, "]]>", "]]]]><![CDATA[>") + "]]>")
+	case CommentNode:
+		sb.WriteString("<!--" + n.Data + "-->")
+	case ProcInstNode:
+		sb.WriteString("<?" + n.Name.Local)
+		if n.Data != "" {
+			sb.WriteString(" " + n.Data)
+		}
+		sb.WriteString("?>")
+	case DirectiveNode:
+		sb.WriteString("<!" + n.Data + ">")
+	}
+}
+
+// qualifiedName returns name with the prefix declared for its namespace in the
+// scope of element n. Attributes cannot use the default namespace
+func (n *XMLNode) qualifiedName(name xml.Name, attr bool) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	if name.Space == xmlNamespaceURI {
+		return "xml:" + name.Local
+	}
+	for e := n; e != nil; e = e.Parent {
+		for _, decl := range e.Attr {
+			if !decl.isNamespaceDecl() || decl.Data != name.Space {
+				continue
+			}
+			if decl.Name.Space == "xmlns" {
+				return decl.Name.Local + ":" + name.Local
+			}
+			if !attr {
+				return name.Local
+			}
+		}
+	}
+	// Undeclared prefixes are kept as the namespace by the decoder
+	return name.Space + ":" + name.Local
+}
+
+// writeInheritedNamespaces writes the namespace declarations of the ancestors
+// of element n that are in scope and not redeclared by n
+func (n *XMLNode) writeInheritedNamespaces(sb *strings.Builder) {
+	declared := make(map[string]bool)
+	for _, decl := range n.Attr {
+		if decl.isNamespaceDecl() {
+			declared[decl.Name.Space+":"+decl.Name.Local] = true
+		}
+	}
+	for e := n.Parent; e != nil; e = e.Parent {
+		for _, decl := range e.Attr {
+			key := decl.Name.Space + ":" + decl.Name.Local
+			if decl.isNamespaceDecl() && !declared[key] {
+				declared[key] = true
+				decl.writeXML(sb, false)
+			}
+		}
+	}
+}
+
+// parseXMLDocument parses UTF-8 XML content into a document tree. Unless the
+// content was transcoded to UTF-8, a declaration of any other encoding is an error
+func parseXMLDocument(xmlContent string, transcoded bool) (*XMLNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(xmlContent))
+	decoder.CharsetReader = xmlCharsetReader(transcoded)
+
+	doc := &XMLNode{Type: DocumentNode}
+	current := doc
+	order := 0
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var node *XMLNode
+		switch t := token.(type) {
+		case xml.StartElement:
+			order++
+			element := &XMLNode{Type: ElementNode, Name: t.Name, Parent: current, order: order}
+			for _, attr := range t.Attr {
+				order++
+				element.Attr = append(element.Attr, &XMLNode{Type: AttributeNode, Name: attr.Name, Data: attr.Value, Parent: element, order: order})
+			}
+			current.Children = append(current.Children, element)
+			current = element
+			continue
+		case xml.EndElement:
+			current = current.Parent
+			continue
+		case xml.CharData:
+			// The decoder reports CDATA sections as character data
+			node = &XMLNode{Type: TextNode, Data: string(t)}
+			if strings.HasPrefix(xmlContent[start:decoder.InputOffset()], "<![CDATA[") {
+				node.Type = CDATANode
+			}
+		case xml.Comment:
+			node = &XMLNode{Type: CommentNode, Data: string(t)}
+		case xml.ProcInst:
+			node = &XMLNode{Type: ProcInstNode, Name: xml.Name{Local: t.Target}, Data: string(t.Inst)}
+		case xml.Directive:
+			node = &XMLNode{Type: DirectiveNode, Data: string(t)}
+		}
+		order++
+		node.Parent = current
+		node.order = order
+		current.Children = append(current.Children, node)
+	}
+
+	if doc.Root() == nil {
+		return nil, fmt.Errorf("no root element found")
+	}
+	return doc, nil
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const domDocument = "<?xml version=\"1.0\"?>\n<!DOCTYPE note>\n" +
+	`<note xmlns="urn:notes" xmlns:m="urn:meta" m:id="1">Dear <to>Ada</to>,<!-- greeting -->` +
+	"\n  <![CDATA[if a < b && c]]> see <m:ref at=\"a&quot;b\tc\"/><?render inline?></note>\n"
+
+// Test the document tree keeps order and node types
+func TestXMLDocumentOrder(t *testing.T) {
+	doc, err := parseXMLDocument(domDocument, false)
+	if err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	var types []string
+	for _, child := range doc.Children {
+		types = append(types, child.Type.String())
+	}
+	if strings.Join(types, ",") != "procinst,text,directive,text,element,text" {
+		t.Errorf("Unexpected document children: %v", types)
+	}
+
+	root := doc.Root()
+	types = nil
+	for _, child := range root.Children {
+		types = append(types, child.Type.String())
+	}
+	expected := "text,element,text,comment,text,cdata,text,element,procinst"
+	if strings.Join(types, ",") != expected {
+		t.Errorf("Expected %s, got %s", expected, strings.Join(types, ","))
+	}
+
+	if root.Children[5].Data != "if a < b && c" {
+		t.Errorf("Expected CDATA text, got %q", root.Children[5].Data)
+	}
+	if root.Children[4].Data != "\n  " {
+		t.Errorf("Expected white space to be kept, got %q", root.Children[4].Data)
+	}
+	if root.Name.Space != "urn:notes" || root.Attribute("id") != "1" {
+		t.Errorf("Unexpected root element %v with id %q", root.Name, root.Attribute("id"))
+	}
+	if elements := root.Elements(); len(elements) != 2 || elements[1].Name.Local != "ref" {
+		t.Errorf("Unexpected child elements: %v", elements)
+	}
+	if got := root.String(); got != "Dear Ada,\n  if a < b && c see " {
+		t.Errorf("Unexpected string value %q", got)
+	}
+}
+
+// Test serializing the document tree
+func TestXMLDocumentSerialize(t *testing.T) {
+	doc, err := parseXMLDocument(domDocument, false)
+	if err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	expected := "<?xml version=\"1.0\"?>\n<!DOCTYPE note>\n" +
+		`<note xmlns="urn:notes" xmlns:m="urn:meta" m:id="1">Dear <to>Ada</to>,<!-- greeting -->` +
+		"\n  <![CDATA[if a < b && c]]> see <m:ref at=\"a&quot;b&#x9;c\"/><?render inline?></note>\n"
+	if got := doc.OuterXML(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	// Serialized subtrees repeat the namespace declarations in scope
+	ref := doc.Root().Elements()[1]
+	if got := ref.OuterXML(); got != `<m:ref at="a&quot;b&#x9;c" xmlns="urn:notes" xmlns:m="urn:meta"/>` {
+		t.Errorf("Unexpected subtree %q", got)
+	}
+	if got := doc.Root().Elements()[0].InnerXML(); got != "Ada" {
+		t.Errorf("Expected 'Ada', got %q", got)
+	}
+
+	// The tree serializes to JSON without parent cycles
+	if _, err := json.Marshal(doc); err != nil {
+		t.Errorf("Failed to marshal document tree: %v", err)
+	}
+}
+
+// Test walking and serializing XMLDoc in templates
+func TestParseXMLDoc(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{range .XMLDoc.Root.Children}}{{.Type}};{{end}}|{{range xmlChildren .XMLDoc.Root}}{{xmlSerialize .}}{{end}}|{{xmlInnerXML (index (xmlChildren .XMLDoc.Root) 0)}}`
+	if err := p.UpdateTemplate("walk", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(`<a><!--x--><b>1</b><c/></a>`))
+	req.Header.Set("Content-Type", "application/xml")
+	var buf bytes.Buffer
+	data, err := p.Parse("walk", req, &buf)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "comment;element;element;|<b>1</b><c/>|1" {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+	if data.XMLDoc == nil || data.BodyXML == nil {
+		t.Error("Expected both XMLDoc and BodyXML to be populated")
+	}
+
+	// Other bodies have no document tree
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	if data, _ := p.Extract(req); data.XMLDoc != nil {
+		t.Errorf("Expected no XMLDoc for JSON, got %v", data.XMLDoc)
+	}
+}
@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"encoding/xml"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// XMLOptions controls how XML bodies are parsed into RequestData.BodyXML
+type XMLOptions struct {
+	// NamespaceAware keys namespaced elements and attributes by "prefix:local",
+	// using the prefix bound to their namespace URI in Namespaces, or by
+	// "{uri}local" when the URI has no prefix there. Namespace declarations are
+	// not reported as attributes. By default only local names are used, so
+	// elements of different namespaces with the same local name share a key
+	NamespaceAware bool
+
+	// Namespaces maps prefixes to namespace URIs, e.g. "soap" to
+	// "http://schemas.xmlsoap.org/soap/envelope/". The prefixes used in the
+	// document do not matter; an empty prefix keys the URI by local name.
+	// The XML functions of the default function map resolve these prefixes; a
+	// custom FuncMap should merge XMLHelper{Namespaces: ...}.FuncMap() for that
+	Namespaces map[string]string
+}
+
+// xmlNamer turns XML names into the keys of parsed XML maps
+type xmlNamer struct {
+	namespaceAware bool
+	prefixes       map[string]string // namespace URI -> prefix
+}
+
+// newXMLNamer creates the namer for options
+func newXMLNamer(options XMLOptions) xmlNamer {
+	namer := xmlNamer{namespaceAware: options.NamespaceAware}
+	if options.NamespaceAware {
+		namer.prefixes = invertNamespaces(options.Namespaces)
+	}
+	return namer
+}
+
+// key returns the map key for name
+func (n xmlNamer) key(name xml.Name) string {
+	if !n.namespaceAware || name.Space == "" {
+		return name.Local
+	}
+	if prefix, ok := n.prefixes[name.Space]; ok {
+		if prefix == "" {
+			return name.Local
+		}
+		return prefix + ":" + name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
+// skipAttr reports whether attr is a namespace declaration to leave out
+func (n xmlNamer) skipAttr(attr xml.Attr) bool {
+	if !n.namespaceAware {
+		return false
+	}
+	return attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns")
+}
+
+// invertNamespaces maps namespace URIs to prefixes. When several prefixes are
+// bound to the same URI, the first one in sort order wins
+func invertNamespaces(namespaces map[string]string) map[string]string {
+	prefixes := make([]string, 0, len(namespaces))
+	for prefix := range namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	uris := make(map[string]string, len(namespaces))
+	for _, prefix := range prefixes {
+		if _, exists := uris[namespaces[prefix]]; !exists {
+			uris[namespaces[prefix]] = prefix
+		}
+	}
+	return uris
+}
+
+// xmlKeySeparator returns the index of the first "/" of key that is not part of
+// a "{uri}" namespace, or -1
+func xmlKeySeparator(key string) int {
+	inURI := false
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '{':
+			inURI = true
+		case '}':
+			inURI = false
+		case '/':
+			if !inURI {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// names returns name followed by its other qualified form, if the prefix or
+// namespace URI of name is bound in h.Namespaces
+func (h XMLHelper) names(name string) []string {
+	if len(h.Namespaces) == 0 {
+		return []string{name}
+	}
+
+	if strings.HasPrefix(name, "{") {
+		if end := strings.Index(name, "}"); end > 0 {
+			uri, local := name[1:end], name[end+1:]
+			if prefix, ok := invertNamespaces(h.Namespaces)[uri]; ok {
+				if prefix == "" {
+					return []string{name, local}
+				}
+				return []string{name, prefix + ":" + local}
+			}
+		}
+	} else if prefix, local, ok := strings.Cut(name, ":"); ok {
+		if uri, ok := h.Namespaces[prefix]; ok {
+			return []string{name, "{" + uri + "}" + local}
+		}
+	}
+	return []string{name}
+}
+
+// elementKey returns the key under which the element name is stored in xmlMap
+func (h XMLHelper) elementKey(xmlMap map[string]interface{}, name string) string {
+	for _, key := range h.names(name) {
+		if _, exists := xmlMap[key]; exists {
+			return key
+		}
+	}
+	return name
+}
+
+// attrKey returns the key under which the attribute of an element is stored in xmlMap
+func (h XMLHelper) attrKey(xmlMap map[string]interface{}, elementName, attrName string) string {
+	for _, element := range h.names(elementName) {
+		for _, attr := range h.names(attrName) {
+			key := element + "/" + attr
+			if _, exists := xmlMap[key]; exists {
+				return key
+			}
+		}
+	}
+	return elementName + "/" + attrName
+}
+
+// FuncMap returns the XML template functions bound to h, as registered by
+// DefaultFuncMap
+func (h XMLHelper) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"xmlAttr":       h.GetXMLAttribute,
+		"xmlAttrArray":  h.GetXMLAttributeArray,
+		"xmlValue":      h.GetXMLValue,
+		"xmlValueArray": h.GetXMLValueArray,
+		"xmlText":       h.GetXMLText,
+		"xmlTextArray":  h.GetXMLTextArray,
+		"hasXMLAttr":    h.HasXMLAttribute,
+		"hasXMLElement": h.HasXMLElement,
+		"isXMLArray":    h.IsXMLArray,
+		"xmlArrayLen":   h.XMLArrayLength,
+		"xmlAttrs":      h.ListXMLAttributes,
+		"xmlElements":   h.ListXMLElements,
+		"xpath":         h.XPath,
+		"xpathAll":      h.XPathAll,
+		"xpathCount":    h.XPathCount,
+		"xmlChildren":   (*XMLNode).Elements,
+		"xmlSerialize":  (*XMLNode).OuterXML,
+		"xmlInnerXML":   (*XMLNode).InnerXML,
+	}
+}
@@ -0,0 +1,192 @@
+package parser
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const soapNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+
+const soapRequest = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Header>
+		<wsse:Security xmlns:wsse="urn:wsse" soap:mustUnderstand="1">token</wsse:Security>
+	</soap:Header>
+	<soap:Body>
+		<ns2:GetOrder xmlns:ns2="urn:orders">
+			<ns2:Body>payload</ns2:Body>
+			<ns2:Id>42</ns2:Id>
+		</ns2:GetOrder>
+	</soap:Body>
+</soap:Envelope>`
+
+// Test local names remain the default
+func TestXMLNamespacesDefault(t *testing.T) {
+	result, err := parseXMLToGeneric(soapRequest)
+	if err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	envelope, ok := result["Envelope"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected Envelope element, got %v", result)
+	}
+	if _, exists := envelope["Body"]; !exists {
+		t.Errorf("Expected Body element keyed by local name, got %v", envelope)
+	}
+	if result["Envelope/soap"] != soapNamespace {
+		t.Errorf("Expected xmlns declaration as attribute, got %v", result["Envelope/soap"])
+	}
+}
+
+// Test namespace-aware parsing with configured and unknown namespaces
+func TestXMLNamespacesAware(t *testing.T) {
+	options := XMLOptions{
+		NamespaceAware: true,
+		Namespaces:     map[string]string{"s": soapNamespace},
+	}
+	result, err := parseXMLWithOptions(soapRequest, options, false)
+	if err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	envelope, ok := result["s:Envelope"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected s:Envelope element, got %v", result)
+	}
+	if _, exists := result["s:Envelope/soap"]; exists {
+		t.Errorf("Expected xmlns declarations to be skipped, got %v", result)
+	}
+
+	body, ok := envelope["s:Body"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected s:Body element, got %v", envelope)
+	}
+	order, ok := body["{urn:orders}GetOrder"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected {urn:orders}GetOrder element, got %v", body)
+	}
+	if _, exists := order["{urn:orders}Body"]; !exists {
+		t.Errorf("Expected payload Body not to collide with s:Body, got %v", order)
+	}
+
+	header := envelope["s:Header"].(map[string]interface{})
+	if header["{urn:wsse}Security/s:mustUnderstand"] != "1" {
+		t.Errorf("Expected namespaced attribute, got %v", header)
+	}
+	if result["s:Envelope/s:Header/{urn:wsse}Security"] != "token" {
+		t.Errorf("Expected flattened path with namespaces, got %v", result["s:Envelope/s:Header/{urn:wsse}Security"])
+	}
+}
+
+// Test the XML helpers resolve prefix:local and {uri}local names
+func TestXMLHelperNamespaces(t *testing.T) {
+	namespaces := map[string]string{"s": soapNamespace, "o": "urn:orders"}
+	result, err := parseXMLWithOptions(soapRequest, XMLOptions{NamespaceAware: true, Namespaces: namespaces}, false)
+	if err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	helper := XMLHelper{Namespaces: namespaces}
+
+	envelope, ok := helper.GetXMLValue(result, "{"+soapNamespace+"}Envelope").(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected envelope by {uri}local, got %v", helper.GetXMLValue(result, "{"+soapNamespace+"}Envelope"))
+	}
+	header := helper.GetXMLValue(envelope, "s:Header").(map[string]interface{})
+	if got := helper.GetXMLAttribute(header, "{urn:orders}Security", "mustUnderstand"); got != "" {
+		t.Errorf("Expected no attribute for another namespace, got %q", got)
+	}
+	if got := helper.GetXMLAttribute(header, "{urn:wsse}Security", "{"+soapNamespace+"}mustUnderstand"); got != "1" {
+		t.Errorf("Expected mustUnderstand to be '1', got %q", got)
+	}
+	if !helper.HasXMLAttribute(header, "{urn:wsse}Security", "s:mustUnderstand") {
+		t.Error("Expected hasXMLAttr to find s:mustUnderstand")
+	}
+	if attrs := helper.ListXMLAttributes(header, "{urn:wsse}Security"); !reflect.DeepEqual(attrs, []string{"s:mustUnderstand"}) {
+		t.Errorf("Expected [s:mustUnderstand], got %v", attrs)
+	}
+
+	// Clark keys contain slashes that are not attribute separators
+	unbound := XMLHelper{}
+	elements := unbound.ListXMLElements(header)
+	sort.Strings(elements)
+	if !reflect.DeepEqual(elements, []string{"{urn:wsse}Security"}) {
+		t.Errorf("Expected [{urn:wsse}Security], got %v", elements)
+	}
+	body := helper.GetXMLValue(envelope, "{"+soapNamespace+"}Body").(map[string]interface{})
+	order := helper.GetXMLValue(body, "{urn:orders}GetOrder").(map[string]interface{})
+	if got := helper.GetXMLText(helper.GetXMLValue(order, "{urn:orders}Id").(map[string]interface{}), "o:Id"); got != "42" {
+		t.Errorf("Expected Id to be '42', got %q", got)
+	}
+}
+
+// Test namespace options are applied when parsing templates
+func TestParseXMLNamespaces(t *testing.T) {
+	p, err := NewParser(Config{
+		XML: XMLOptions{NamespaceAware: true, Namespaces: map[string]string{"soap": soapNamespace, "o": "urn:orders"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{$env := xmlValue .BodyXML "soap:Envelope"}}{{$body := xmlValue $env "{http://schemas.xmlsoap.org/soap/envelope/}Body"}}{{$order := xmlValue $body "o:GetOrder"}}{{xmlText (xmlValue $order "o:Body") "{urn:orders}Body"}}`
+	if err := p.UpdateTemplate("order", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(soapRequest))
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	var buf bytes.Buffer
+	if _, err := p.Parse("order", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "payload" {
+		t.Errorf("Expected 'payload', got %q", buf.String())
+	}
+}
+
+// Test a custom FuncMap is used as is and can merge the namespace-aware XML functions
+func TestParseXMLNamespacesCustomFuncMap(t *testing.T) {
+	options := XMLOptions{NamespaceAware: true, Namespaces: map[string]string{"soap": soapNamespace, "o": "urn:orders"}}
+
+	funcMap := DefaultFuncMap()
+	delete(funcMap, "xmlText")
+	p, err := NewParser(Config{FuncMap: funcMap, XML: options})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+	if err := p.UpdateTemplate("text", `{{xmlText .BodyXML "a"}}`); err == nil {
+		t.Error("Expected a function left out of a custom FuncMap not to be added")
+	}
+
+	funcMap = DefaultFuncMap()
+	for name, fn := range (XMLHelper{Namespaces: options.Namespaces}).FuncMap() {
+		funcMap[name] = fn
+	}
+	funcMap["xmlAttr"] = func(v interface{}, element, attr string) string { return "custom" }
+	p, err = NewParser(Config{FuncMap: funcMap, XML: options})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{$env := xmlValue .BodyXML "soap:Envelope"}}{{$body := xmlValue $env "{http://schemas.xmlsoap.org/soap/envelope/}Body"}}{{$order := xmlValue $body "o:GetOrder"}}{{xmlText (xmlValue $order "o:Body") "{urn:orders}Body"}} {{xmlAttr .BodyXML "a" "b"}}`
+	if err := p.UpdateTemplate("order", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(soapRequest))
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	var buf bytes.Buffer
+	if _, err := p.Parse("order", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "payload custom" {
+		t.Errorf("Expected 'payload custom', got %q", buf.String())
+	}
+}
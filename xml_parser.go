@@ -9,15 +9,23 @@ import (
 )
 
 // parseXMLToGeneric parses XML content into a generic map structure for template use
+// The content must be UTF-8; a declaration of any other encoding is an error
 // Returns a hierarchical structure where attributes are flattened with elementName/attributeName format
 func parseXMLToGeneric(xmlContent string) (map[string]interface{}, error) {
+	return parseXMLWithOptions(xmlContent, XMLOptions{}, false)
+}
+
+// parseXMLWithOptions parses XML content like parseXMLToGeneric, naming elements
+// and attributes according to options. Content transcoded to UTF-8 is parsed
+// whatever encoding it declares
+func parseXMLWithOptions(xmlContent string, options XMLOptions, transcoded bool) (map[string]interface{}, error) {
 	if strings.TrimSpace(xmlContent) == "" {
 		slog.Debug("Empty XML content provided")
 		return nil, fmt.Errorf("empty XML content")
 	}
 
 	// Parse XML into hierarchical format with flattened attributes
-	parsedRoot, err := parseXMLHierarchical(xmlContent)
+	parsedRoot, err := parseXMLHierarchical(xmlContent, newXMLNamer(options), transcoded)
 	if err != nil {
 		slog.Debug("XML parsing failed", "error", err, "xml_length", len(xmlContent))
 		return nil, err
@@ -28,8 +36,9 @@ func parseXMLToGeneric(xmlContent string) (map[string]interface{}, error) {
 }
 
 // parseXMLHierarchical parses XML into a hybrid structure with both flattened paths and nested maps
-func parseXMLHierarchical(xmlContent string) (map[string]interface{}, error) {
+func parseXMLHierarchical(xmlContent string, namer xmlNamer, transcoded bool) (map[string]interface{}, error) {
 	decoder := xml.NewDecoder(strings.NewReader(xmlContent))
+	decoder.CharsetReader = xmlCharsetReader(transcoded)
 
 	for {
 		token, err := decoder.Token()
@@ -44,19 +53,23 @@ func parseXMLHierarchical(xmlContent string) (map[string]interface{}, error) {
 		case xml.StartElement:
 			// Parse with both flattened and hierarchical structures
 			result := make(map[string]interface{})
-			nestedResult, err := parseXMLElementHybrid(decoder, t, "", result)
+			nestedResult, err := parseXMLElementHybrid(decoder, t, "", result, namer)
 			if err != nil {
 				return nil, err
 			}
 
 			// Add the root element as a nested structure
-			result[t.Name.Local] = nestedResult
+			rootName := namer.key(t.Name)
+			result[rootName] = nestedResult
 
 			// Add root element attributes at the top level for optimized structure
 			for _, attr := range t.Attr {
-				attrName := attr.Name.Local
+				if namer.skipAttr(attr) {
+					continue
+				}
+				attrName := namer.key(attr.Name)
 				attrValue := attr.Value
-				rootAttrKey := fmt.Sprintf("%s/%s", t.Name.Local, attrName)
+				rootAttrKey := fmt.Sprintf("%s/%s", rootName, attrName)
 				result[rootAttrKey] = attrValue
 			}
 
@@ -66,8 +79,8 @@ func parseXMLHierarchical(xmlContent string) (map[string]interface{}, error) {
 }
 
 // parseXMLElementHybrid creates both flattened paths and nested map structures
-func parseXMLElementHybrid(decoder *xml.Decoder, startElement xml.StartElement, parentPath string, flatResult map[string]interface{}) (map[string]interface{}, error) {
-	elementName := startElement.Name.Local
+func parseXMLElementHybrid(decoder *xml.Decoder, startElement xml.StartElement, parentPath string, flatResult map[string]interface{}, namer xmlNamer) (map[string]interface{}, error) {
+	elementName := namer.key(startElement.Name)
 	nestedResult := make(map[string]interface{})
 
 	var currentPath string
@@ -81,7 +94,10 @@ func parseXMLElementHybrid(decoder *xml.Decoder, startElement xml.StartElement,
 
 	// Add element attributes to both flattened and nested structures
 	for _, attr := range startElement.Attr {
-		attrName := attr.Name.Local
+		if namer.skipAttr(attr) {
+			continue
+		}
+		attrName := namer.key(attr.Name)
 		attrValue := attr.Value
 
 		// Flattened path: full path from root
@@ -116,10 +132,10 @@ func parseXMLElementHybrid(decoder *xml.Decoder, startElement xml.StartElement,
 		switch t := token.(type) {
 		case xml.StartElement:
 			hasChildren = true
-			childName := t.Name.Local
+			childName := namer.key(t.Name)
 
 			// Parse child recursively
-			childNested, err := parseXMLElementHybrid(decoder, t, currentPath, flatResult)
+			childNested, err := parseXMLElementHybrid(decoder, t, currentPath, flatResult, namer)
 			if err != nil {
 				return nil, err
 			}
@@ -140,7 +156,10 @@ func parseXMLElementHybrid(decoder *xml.Decoder, startElement xml.StartElement,
 			// This creates the optimized structure where attributes are at the same level as the element
 			childStartElement := t // t is the xml.StartElement for the child
 			for _, attr := range childStartElement.Attr {
-				attrName := attr.Name.Local
+				if namer.skipAttr(attr) {
+					continue
+				}
+				attrName := namer.key(attr.Name)
 				attrValue := attr.Value
 				childAttrKey := fmt.Sprintf("%s/%s", childName, attrName)
 
@@ -167,7 +186,7 @@ func parseXMLElementHybrid(decoder *xml.Decoder, startElement xml.StartElement,
 			}
 
 		case xml.EndElement:
-			if t.Name.Local == elementName {
+			if namer.key(t.Name) == elementName {
 				finalText := strings.TrimSpace(textContent.String())
 
 				// Handle text content for both structures
@@ -226,14 +245,19 @@ func parseXMLElementHybrid(decoder *xml.Decoder, startElement xml.StartElement,
 }
 
 // XMLHelper provides template functions for XML manipulation
-type XMLHelper struct{}
+type XMLHelper struct {
+	// Namespaces maps prefixes to namespace URIs, so that elements and
+	// attributes parsed with XMLOptions.NamespaceAware can be looked up as
+	// either "prefix:local" or "{uri}local"
+	Namespaces map[string]string
+}
 
 // GetXMLAttribute extracts a specific attribute from an XML node map
 // Usage: {{xmlAttr .BodyXML "key" "attr1"}} to get the 'attr1' attribute from 'key' element
 // Works with format (key/attr)
 func (h XMLHelper) GetXMLAttribute(xmlMap map[string]interface{}, elementName, attrName string) string {
 	// Try new flattened format
-	attrKey := fmt.Sprintf("%s/%s", elementName, attrName)
+	attrKey := h.attrKey(xmlMap, elementName, attrName)
 	if attr, exists := xmlMap[attrKey]; exists {
 		switch attrVal := attr.(type) {
 		case string:
@@ -252,7 +276,7 @@ func (h XMLHelper) GetXMLAttribute(xmlMap map[string]interface{}, elementName, a
 // GetXMLAttributeArray extracts all attribute values as an array
 // Usage: {{xmlAttrArray .BodyXML "item" "id"}} to get all 'id' attributes from 'item' elements
 func (h XMLHelper) GetXMLAttributeArray(xmlMap map[string]interface{}, elementName, attrName string) []string {
-	attrKey := fmt.Sprintf("%s/%s", elementName, attrName)
+	attrKey := h.attrKey(xmlMap, elementName, attrName)
 	var result []string
 
 	if attr, exists := xmlMap[attrKey]; exists {
@@ -274,7 +298,7 @@ func (h XMLHelper) GetXMLAttributeArray(xmlMap map[string]interface{}, elementNa
 // Usage: {{xmlValue .BodyXML "key"}} to get the value of 'key' element
 // For arrays: returns the first element
 func (h XMLHelper) GetXMLValue(xmlMap map[string]interface{}, elementName string) interface{} {
-	if value, exists := xmlMap[elementName]; exists {
+	if value, exists := xmlMap[h.elementKey(xmlMap, elementName)]; exists {
 		switch val := value.(type) {
 		case []interface{}:
 			if len(val) > 0 {
@@ -291,7 +315,7 @@ func (h XMLHelper) GetXMLValue(xmlMap map[string]interface{}, elementName string
 // GetXMLValueArray extracts all values of an XML element as an array
 // Usage: {{xmlValueArray .BodyXML "item"}} to get all 'item' element values
 func (h XMLHelper) GetXMLValueArray(xmlMap map[string]interface{}, elementName string) []interface{} {
-	if value, exists := xmlMap[elementName]; exists {
+	if value, exists := xmlMap[h.elementKey(xmlMap, elementName)]; exists {
 		switch val := value.(type) {
 		case []interface{}:
 			return val
@@ -328,22 +352,21 @@ func (h XMLHelper) GetXMLTextArray(xmlMap map[string]interface{}, elementName st
 // HasXMLAttribute checks if an XML element has a specific attribute
 // Usage: {{hasXMLAttr .BodyXML "key" "attr1"}}
 func (h XMLHelper) HasXMLAttribute(xmlMap map[string]interface{}, elementName, attrName string) bool {
-	attrKey := fmt.Sprintf("%s/%s", elementName, attrName)
-	_, exists := xmlMap[attrKey]
+	_, exists := xmlMap[h.attrKey(xmlMap, elementName, attrName)]
 	return exists
 }
 
 // HasXMLElement checks if an XML element exists
 // Usage: {{hasXMLElement .BodyXML "key"}}
 func (h XMLHelper) HasXMLElement(xmlMap map[string]interface{}, elementName string) bool {
-	_, exists := xmlMap[elementName]
+	_, exists := xmlMap[h.elementKey(xmlMap, elementName)]
 	return exists
 }
 
 // IsXMLArray checks if an XML element is an array (has multiple values)
 // Usage: {{isXMLArray .BodyXML "item"}}
 func (h XMLHelper) IsXMLArray(xmlMap map[string]interface{}, elementName string) bool {
-	if value, exists := xmlMap[elementName]; exists {
+	if value, exists := xmlMap[h.elementKey(xmlMap, elementName)]; exists {
 		_, isArray := value.([]interface{})
 		return isArray
 	}
@@ -353,7 +376,7 @@ func (h XMLHelper) IsXMLArray(xmlMap map[string]interface{}, elementName string)
 // XMLArrayLength returns the length of an XML element array
 // Usage: {{xmlArrayLen .BodyXML "item"}}
 func (h XMLHelper) XMLArrayLength(xmlMap map[string]interface{}, elementName string) int {
-	if value, exists := xmlMap[elementName]; exists {
+	if value, exists := xmlMap[h.elementKey(xmlMap, elementName)]; exists {
 		switch val := value.(type) {
 		case []interface{}:
 			return len(val)
@@ -368,12 +391,12 @@ func (h XMLHelper) XMLArrayLength(xmlMap map[string]interface{}, elementName str
 // Usage: {{range xmlAttrs .BodyXML "key"}}{{.}}{{end}}
 func (h XMLHelper) ListXMLAttributes(xmlMap map[string]interface{}, elementName string) []string {
 	var attrs []string
-	prefix := elementName + "/"
+	prefix := h.elementKey(xmlMap, elementName) + "/"
 	for key := range xmlMap {
 		if strings.HasPrefix(key, prefix) {
 			attrName := strings.TrimPrefix(key, prefix)
 			// Make sure it's a direct attribute, not a nested element
-			if !strings.Contains(attrName, "/") {
+			if xmlKeySeparator(attrName) < 0 {
 				attrs = append(attrs, attrName)
 			}
 		}
@@ -386,8 +409,8 @@ func (h XMLHelper) ListXMLAttributes(xmlMap map[string]interface{}, elementName
 func (h XMLHelper) ListXMLElements(xmlMap map[string]interface{}) []string {
 	var elements []string
 	for key := range xmlMap {
-		// Skip attribute keys (those containing "/")
-		if !strings.Contains(key, "/") {
+		// Skip attribute keys (those containing "/" outside a namespace URI)
+		if xmlKeySeparator(key) < 0 {
 			elements = append(elements, key)
 		}
 	}
@@ -0,0 +1,570 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The XPath functions evaluate a subset of XPath 1.0 against the document tree
+// of an XML body:
+//
+//	/order/item          absolute and relative location paths
+//	//item, .//price     descendants at any depth
+//	., .., *, @id, @*    self, parent, any element and attributes
+//	text(), node()       text (including CDATA) and any child nodes
+//	item[2], item[last()]                 positional predicates
+//	item[@id='7'], item[price!=0], item[@sku]  comparisons and existence tests
+//
+// Unprefixed names match elements of any namespace. Prefixed names such as
+// soap:Body and {uri}local names match the namespace URI, where prefixes are
+// resolved through XMLHelper.Namespaces.
+
+// xpathTokenKind identifies a lexical token of an XPath expression
+type xpathTokenKind int
+
+const (
+	xpathSlash xpathTokenKind = iota + 1
+	xpathDoubleSlash
+	xpathLBracket
+	xpathRBracket
+	xpathLParen
+	xpathRParen
+	xpathAt
+	xpathStar
+	xpathDot
+	xpathDotDot
+	xpathEq
+	xpathNeq
+	xpathName
+	xpathString
+	xpathNumber
+)
+
+// xpathPunctuation maps single-character tokens to their kind
+var xpathPunctuation = map[byte]xpathTokenKind{
+	'[': xpathLBracket,
+	']': xpathRBracket,
+	'(': xpathLParen,
+	')': xpathRParen,
+	'@': xpathAt,
+	'*': xpathStar,
+	'=': xpathEq,
+}
+
+// xpathToken is a lexical token of an XPath expression
+type xpathToken struct {
+	kind xpathTokenKind
+	text string
+}
+
+// lexXPath splits an XPath expression into tokens
+func lexXPath(expr string) ([]xpathToken, error) {
+	var tokens []xpathToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '/':
+			if strings.HasPrefix(expr[i:], "//") {
+				tokens = append(tokens, xpathToken{kind: xpathDoubleSlash})
+				i += 2
+			} else {
+				tokens = append(tokens, xpathToken{kind: xpathSlash})
+				i++
+			}
+		case xpathPunctuation[c] != 0:
+			tokens = append(tokens, xpathToken{kind: xpathPunctuation[c]})
+			i++
+		case c == '!' && strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, xpathToken{kind: xpathNeq})
+			i += 2
+		case c == '.' && strings.HasPrefix(expr[i:], ".."):
+			tokens = append(tokens, xpathToken{kind: xpathDotDot})
+			i += 2
+		case c == '.' && (i+1 >= len(expr) || !isDigit(expr[i+1])):
+			tokens = append(tokens, xpathToken{kind: xpathDot})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string literal at offset %d", i)
+			}
+			tokens = append(tokens, xpathToken{kind: xpathString, text: expr[i+1 : i+1+end]})
+			i += end + 2
+		case isDigit(c) || c == '.':
+			start := i
+			for i < len(expr) && (isDigit(expr[i]) || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, xpathToken{kind: xpathNumber, text: expr[start:i]})
+		case c == '{' || isXPathNameStart(c):
+			start := i
+			if c == '{' {
+				end := strings.IndexByte(expr[i:], '}')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated namespace URI at offset %d", i)
+				}
+				i += end + 1
+			}
+			for i < len(expr) && isXPathNameChar(expr[i]) {
+				i++
+			}
+			// Accept prefix:* wildcards
+			if strings.HasSuffix(expr[start:i], ":") && i < len(expr) && expr[i] == '*' {
+				i++
+			}
+			tokens = append(tokens, xpathToken{kind: xpathName, text: expr[start:i]})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isXPathNameStart reports whether c can start an XML name
+func isXPathNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// isXPathNameChar reports whether c can appear in a qualified XML name
+func isXPathNameChar(c byte) bool {
+	return isXPathNameStart(c) || isDigit(c) || c == '-' || c == '.' || c == ':'
+}
+
+// xpathAxis is the direction of a location step
+type xpathAxis int
+
+const (
+	xpathChildAxis xpathAxis = iota
+	xpathAttributeAxis
+	xpathSelfAxis
+	xpathParentAxis
+	xpathDescendantOrSelfAxis
+)
+
+// xpathNodeTest selects nodes on an axis
+type xpathNodeTest struct {
+	text  bool // text()
+	node  bool // node()
+	local string
+	space string
+	// qualified requires the namespace URI to match space
+	qualified bool
+}
+
+// matches reports whether n passes the test on axis
+func (t xpathNodeTest) matches(n *XMLNode, axis xpathAxis) bool {
+	switch {
+	case t.node:
+		return true
+	case t.text:
+		return n.Type == TextNode || n.Type == CDATANode
+	}
+
+	principal := ElementNode
+	if axis == xpathAttributeAxis {
+		principal = AttributeNode
+	}
+	if n.Type != principal {
+		return false
+	}
+	if t.qualified && n.Name.Space != t.space {
+		return false
+	}
+	return t.local == "*" || t.local == n.Name.Local
+}
+
+// xpathPredicate filters the nodes selected by a step
+type xpathPredicate struct {
+	position int  // [n]
+	last     bool // [last()]
+
+	path    *xpathExpr
+	op      xpathTokenKind // xpathEq or xpathNeq, 0 without a comparison
+	literal string
+	number  bool
+}
+
+// matches reports whether the node at 1-based position of size nodes passes the predicate
+func (p xpathPredicate) matches(n *XMLNode, position, size int) bool {
+	switch {
+	case p.position > 0:
+		return position == p.position
+	case p.last:
+		return position == size
+	}
+
+	values := p.path.evaluate(n)
+	if p.op == 0 {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if equal := p.equals(value.String()); equal == (p.op == xpathEq) {
+			return true
+		}
+	}
+	return false
+}
+
+// equals compares value with the literal of the predicate, numerically for number literals
+func (p xpathPredicate) equals(value string) bool {
+	if !p.number {
+		return value == p.literal
+	}
+	a, errA := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	b, errB := strconv.ParseFloat(p.literal, 64)
+	return errA == nil && errB == nil && a == b
+}
+
+// xpathStep is a location step
+type xpathStep struct {
+	axis       xpathAxis
+	test       xpathNodeTest
+	predicates []xpathPredicate
+}
+
+// apply evaluates the step for every context node and returns the distinct
+// results in document order
+func (s xpathStep) apply(contexts []*XMLNode) []*XMLNode {
+	var result []*XMLNode
+	seen := make(map[*XMLNode]bool)
+	for _, context := range contexts {
+		candidates := s.candidates(context)
+		for _, predicate := range s.predicates {
+			var kept []*XMLNode
+			for i, n := range candidates {
+				if predicate.matches(n, i+1, len(candidates)) {
+					kept = append(kept, n)
+				}
+			}
+			candidates = kept
+		}
+		for _, n := range candidates {
+			if !seen[n] {
+				seen[n] = true
+				result = append(result, n)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].order < result[j].order })
+	return result
+}
+
+// candidates returns the nodes on the axis of context that pass the node test
+func (s xpathStep) candidates(context *XMLNode) []*XMLNode {
+	var nodes []*XMLNode
+	switch s.axis {
+	case xpathChildAxis:
+		nodes = context.Children
+	case xpathAttributeAxis:
+		for _, attr := range context.Attr {
+			if !attr.isNamespaceDecl() {
+				nodes = append(nodes, attr)
+			}
+		}
+	case xpathSelfAxis:
+		nodes = []*XMLNode{context}
+	case xpathParentAxis:
+		if context.Parent != nil {
+			nodes = []*XMLNode{context.Parent}
+		}
+	case xpathDescendantOrSelfAxis:
+		var walk func(n *XMLNode)
+		walk = func(n *XMLNode) {
+			nodes = append(nodes, n)
+			for _, child := range n.Children {
+				walk(child)
+			}
+		}
+		walk(context)
+	}
+
+	var matched []*XMLNode
+	for _, n := range nodes {
+		if s.test.matches(n, s.axis) {
+			matched = append(matched, n)
+		}
+	}
+	return matched
+}
+
+// xpathExpr is a compiled location path
+type xpathExpr struct {
+	absolute bool
+	steps    []xpathStep
+}
+
+// evaluate returns the nodes selected from context, in document order
+func (e *xpathExpr) evaluate(context *XMLNode) []*XMLNode {
+	if e.absolute {
+		for context.Parent != nil {
+			context = context.Parent
+		}
+	}
+	nodes := []*XMLNode{context}
+	for _, step := range e.steps {
+		nodes = step.apply(nodes)
+	}
+	return nodes
+}
+
+// descendantOrSelfStep is the step implied by "//"
+var descendantOrSelfStep = xpathStep{axis: xpathDescendantOrSelfAxis, test: xpathNodeTest{node: true}}
+
+// xpathParser compiles tokens into an expression
+type xpathParser struct {
+	tokens     []xpathToken
+	pos        int
+	namespaces map[string]string
+}
+
+// compileXPath compiles expr, resolving prefixes through namespaces
+func compileXPath(expr string, namespaces map[string]string) (*xpathExpr, error) {
+	tokens, err := lexXPath(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XPath expression %q: %w", expr, err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("invalid XPath expression %q: empty expression", expr)
+	}
+
+	p := &xpathParser{tokens: tokens, namespaces: namespaces}
+	compiled, err := p.parsePath()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected token at position %d", p.pos+1)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid XPath expression %q: %w", expr, err)
+	}
+	return compiled, nil
+}
+
+// peek reports whether the next token is of kind
+func (p *xpathParser) peek(kind xpathTokenKind) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == kind
+}
+
+// expect consumes a token of kind
+func (p *xpathParser) expect(kind xpathTokenKind, what string) error {
+	if !p.peek(kind) {
+		return fmt.Errorf("expected %s at position %d", what, p.pos+1)
+	}
+	p.pos++
+	return nil
+}
+
+// atStep reports whether the next token starts a location step
+func (p *xpathParser) atStep() bool {
+	return p.peek(xpathDot) || p.peek(xpathDotDot) || p.peek(xpathAt) || p.peek(xpathStar) || p.peek(xpathName)
+}
+
+// parsePath parses an absolute or relative location path
+func (p *xpathParser) parsePath() (*xpathExpr, error) {
+	expr := &xpathExpr{}
+	switch {
+	case p.peek(xpathSlash):
+		p.pos++
+		expr.absolute = true
+		if !p.atStep() {
+			return expr, nil
+		}
+	case p.peek(xpathDoubleSlash):
+		p.pos++
+		expr.absolute = true
+		expr.steps = append(expr.steps, descendantOrSelfStep)
+	}
+
+	for {
+		step, err := p.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		expr.steps = append(expr.steps, step)
+
+		switch {
+		case p.peek(xpathSlash):
+			p.pos++
+		case p.peek(xpathDoubleSlash):
+			p.pos++
+			expr.steps = append(expr.steps, descendantOrSelfStep)
+		default:
+			return expr, nil
+		}
+	}
+}
+
+// parseStep parses a location step with its predicates
+func (p *xpathParser) parseStep() (xpathStep, error) {
+	var step xpathStep
+	switch {
+	case p.peek(xpathDot):
+		p.pos++
+		return xpathStep{axis: xpathSelfAxis, test: xpathNodeTest{node: true}}, nil
+	case p.peek(xpathDotDot):
+		p.pos++
+		return xpathStep{axis: xpathParentAxis, test: xpathNodeTest{node: true}}, nil
+	case p.peek(xpathAt):
+		p.pos++
+		step.axis = xpathAttributeAxis
+		if !p.peek(xpathStar) && !p.peek(xpathName) {
+			return step, fmt.Errorf("expected attribute name at position %d", p.pos+1)
+		}
+	}
+
+	switch {
+	case p.peek(xpathStar):
+		p.pos++
+		step.test = xpathNodeTest{local: "*"}
+	case p.peek(xpathName):
+		name := p.tokens[p.pos].text
+		p.pos++
+		if p.peek(xpathLParen) && step.axis == xpathChildAxis {
+			p.pos++
+			if err := p.expect(xpathRParen, "')'"); err != nil {
+				return step, err
+			}
+			switch name {
+			case "text":
+				step.test = xpathNodeTest{text: true}
+			case "node":
+				step.test = xpathNodeTest{node: true}
+			default:
+				return step, fmt.Errorf("unsupported node test %s()", name)
+			}
+		} else {
+			test, err := p.nameTest(name)
+			if err != nil {
+				return step, err
+			}
+			step.test = test
+		}
+	default:
+		return step, fmt.Errorf("expected location step at position %d", p.pos+1)
+	}
+
+	for p.peek(xpathLBracket) {
+		p.pos++
+		predicate, err := p.parsePredicate()
+		if err != nil {
+			return step, err
+		}
+		if err := p.expect(xpathRBracket, "']'"); err != nil {
+			return step, err
+		}
+		step.predicates = append(step.predicates, predicate)
+	}
+	return step, nil
+}
+
+// nameTest resolves a prefix:local, {uri}local or local name test
+func (p *xpathParser) nameTest(name string) (xpathNodeTest, error) {
+	if strings.HasPrefix(name, "{") {
+		end := strings.IndexByte(name, '}')
+		return xpathNodeTest{space: name[1:end], local: name[end+1:], qualified: true}, nil
+	}
+	if prefix, local, ok := strings.Cut(name, ":"); ok {
+		uri, bound := p.namespaces[prefix]
+		if !bound {
+			return xpathNodeTest{}, fmt.Errorf("undefined namespace prefix %q", prefix)
+		}
+		return xpathNodeTest{space: uri, local: local, qualified: true}, nil
+	}
+	return xpathNodeTest{local: name}, nil
+}
+
+// parsePredicate parses the expression between brackets
+func (p *xpathParser) parsePredicate() (xpathPredicate, error) {
+	var predicate xpathPredicate
+	if p.peek(xpathNumber) && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == xpathRBracket {
+		position, err := strconv.Atoi(p.tokens[p.pos].text)
+		if err != nil || position < 1 {
+			return predicate, fmt.Errorf("invalid position %s", p.tokens[p.pos].text)
+		}
+		p.pos++
+		predicate.position = position
+		return predicate, nil
+	}
+	if p.peek(xpathName) && p.tokens[p.pos].text == "last" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == xpathLParen {
+		p.pos += 2
+		predicate.last = true
+		return predicate, p.expect(xpathRParen, "')'")
+	}
+
+	path, err := p.parsePath()
+	if err != nil {
+		return predicate, err
+	}
+	predicate.path = path
+
+	if p.peek(xpathEq) || p.peek(xpathNeq) {
+		predicate.op = p.tokens[p.pos].kind
+		p.pos++
+		switch {
+		case p.peek(xpathString):
+			predicate.literal = p.tokens[p.pos].text
+		case p.peek(xpathNumber):
+			predicate.literal = p.tokens[p.pos].text
+			predicate.number = true
+		default:
+			return predicate, fmt.Errorf("expected literal at position %d", p.pos+1)
+		}
+		p.pos++
+	}
+	return predicate, nil
+}
+
+// xpathContext returns the node that expressions are evaluated against
+func xpathContext(context interface{}) (*XMLNode, error) {
+	switch c := context.(type) {
+	case nil:
+		return nil, nil
+	case *RequestData:
+		if c == nil {
+			return nil, nil
+		}
+		return c.XMLDoc, nil
+	case *XMLNode:
+		return c, nil
+	}
+	return nil, fmt.Errorf("xpath: unsupported context %T", context)
+}
+
+// XPathAll returns the nodes selected by expr. The context is the request data,
+// whose XML body is queried, or a node returned by an earlier query
+// Usage: {{range xpathAll . "//item[@id='7']"}}{{xpath . "price"}}{{end}}
+func (h XMLHelper) XPathAll(context interface{}, expr string) ([]*XMLNode, error) {
+	compiled, err := compileXPath(expr, h.Namespaces)
+	if err != nil {
+		return nil, err
+	}
+	node, err := xpathContext(context)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return compiled.evaluate(node), nil
+}
+
+// XPath returns the string value of the first node selected by expr, or ""
+// Usage: {{xpath . "//item[@id='7']/price"}}
+func (h XMLHelper) XPath(context interface{}, expr string) (string, error) {
+	nodes, err := h.XPathAll(context, expr)
+	if err != nil || len(nodes) == 0 {
+		return "", err
+	}
+	return nodes[0].String(), nil
+}
+
+// XPathCount returns the number of nodes selected by expr
+// Usage: {{xpathCount . "//item"}}
+func (h XMLHelper) XPathCount(context interface{}, expr string) (int, error) {
+	nodes, err := h.XPathAll(context, expr)
+	return len(nodes), err
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const xpathOrder = `<order id="1" xmlns:p="urn:pricing">
+	<item id="5"><name>Pen</name><price>1.50</price></item>
+	<item id="7" sku="X7"><name>Ink</name><price>12</price></item>
+	<item id="9"><name>Pad</name><p:price>3</p:price></item>
+	<note>Leave at <b>door</b></note>
+</order>`
+
+// Test XPath expressions against a parsed document
+func TestXPath(t *testing.T) {
+	doc, err := parseXMLDocument(xpathOrder, false)
+	if err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	helper := XMLHelper{Namespaces: map[string]string{"pr": "urn:pricing"}}
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"/order/@id", "1"},
+		{"/order/item[@id='7']/price", "12"},
+		{"//item[@id=7]/name", "Ink"},
+		{"//item[2]/name", "Ink"},
+		{"//item[last()]/name", "Pad"},
+		{"//item[@sku]/@id", "7"},
+		{"//item[name='Pad']/@id", "9"},
+		{"//item[price!=1.5]/name", "Ink"},
+		{"//pr:price", "3"},
+		{"//{urn:pricing}price/../name", "Pad"},
+		{"/order/note/text()", "Leave at "},
+		{"/order/note", "Leave at door"},
+		{"//item[@id='8']", ""},
+		{"/order/*[4]/b", "door"},
+	}
+	for _, tt := range tests {
+		got, err := helper.XPath(&RequestData{XMLDoc: doc}, tt.expr)
+		if err != nil {
+			t.Errorf("XPath %q failed: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("XPath %q: expected %q, got %q", tt.expr, tt.expected, got)
+		}
+	}
+
+	// Unprefixed names match any namespace
+	if count, _ := helper.XPathCount(doc, "//price"); count != 3 {
+		t.Errorf("Expected 3 prices, got %d", count)
+	}
+	if count, _ := helper.XPathCount(doc, "/order/@*"); count != 1 {
+		t.Errorf("Expected namespace declarations to be skipped, got %d attributes", count)
+	}
+
+	// Relative queries from returned nodes
+	items, err := helper.XPathAll(doc, "//item")
+	if err != nil || len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %v (%v)", items, err)
+	}
+	if got, _ := helper.XPath(items[1], "./name"); got != "Ink" {
+		t.Errorf("Expected 'Ink', got %q", got)
+	}
+	if got, _ := helper.XPath(items[1], "/order/item[1]/name"); got != "Pen" {
+		t.Errorf("Expected absolute path from a node to start at the root, got %q", got)
+	}
+}
+
+// Test XPath results are in document order across context nodes
+func TestXPathDocumentOrder(t *testing.T) {
+	doc, err := parseXMLDocument(`<r><a><b id="1"/></a><b id="2"/><c><b id="3"/></c></r>`, false)
+	if err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	helper := XMLHelper{}
+
+	if got, _ := helper.XPath(doc, "//b/@id"); got != "1" {
+		t.Errorf("Expected '1', got %q", got)
+	}
+	nodes, err := helper.XPathAll(doc, "//b/@id")
+	if err != nil {
+		t.Fatalf("XPath failed: %v", err)
+	}
+	var ids []string
+	for _, n := range nodes {
+		ids = append(ids, n.String())
+	}
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Errorf("Expected 1,2,3, got %v", ids)
+	}
+}
+
+// Test invalid XPath expressions and contexts
+func TestXPathErrors(t *testing.T) {
+	helper := XMLHelper{}
+	doc, _ := parseXMLDocument("<a/>", false)
+
+	for _, expr := range []string{"", "/a[", "//a[@id=]", "p:a", "a[0]", "count(a)", "a'"} {
+		if _, err := helper.XPath(doc, expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+	if _, err := helper.XPath("text", "/a"); err == nil {
+		t.Error("Expected error for unsupported context")
+	}
+
+	// Requests without an XML body have no matches
+	if got, err := helper.XPath(&RequestData{}, "/a"); err != nil || got != "" {
+		t.Errorf("Expected empty result, got %q (%v)", got, err)
+	}
+}
+
+// Test the xpath template functions
+func TestParseXPath(t *testing.T) {
+	p, err := NewParser(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := `{{xpathCount . "//item"}}:{{xpath . "//item[@id='7']/price"}}:{{range xpathAll . "//item[price>0 or @sku]"}}{{end}}`
+	if err := p.UpdateTemplate("bad", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	content = `{{xpathCount . "//item"}}:{{xpath . "//item[@id='7']/price"}}:{{range xpathAll . "//item"}}{{xpath . "@id"}}{{end}}`
+	if err := p.UpdateTemplate("order", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(xpathOrder))
+	req.Header.Set("Content-Type", "application/xml")
+	var buf bytes.Buffer
+	if _, err := p.Parse("order", req, &buf); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if buf.String() != "3:12:579" {
+		t.Errorf("Expected '3:12:579', got %q", buf.String())
+	}
+
+	req, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader(xpathOrder))
+	req.Header.Set("Content-Type", "application/xml")
+	if _, err := p.Parse("bad", req, &bytes.Buffer{}); err == nil {
+		t.Error("Expected unsupported XPath syntax to fail the template")
+	}
+}
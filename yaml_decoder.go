@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlMediaTypes are the media types decoded as YAML by default, in addition to
+// any media type with the +yaml suffix
+var yamlMediaTypes = []string{
+	"application/yaml",
+	"application/x-yaml",
+	"text/yaml",
+	"text/x-yaml",
+}
+
+// YAMLDecoder is the built-in decoder for YAML media types. Only the first
+// document of a multi-document stream is decoded. Mappings are decoded as
+// map[string]interface{} so the result can be used like BodyJSON; the result
+// is also exposed as RequestData.BodyYAML.
+type YAMLDecoder struct{}
+
+// Decode implements BodyDecoder
+func (YAMLDecoder) Decode(body []byte, contentType string) (interface{}, error) {
+	return decodeYAML(body)
+}
+
+// decodeYAML decodes the first YAML document into JSON-compatible values
+func decodeYAML(data []byte) (interface{}, error) {
+	var value interface{}
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return normalizeYAML(value), nil
+}
+
+// normalizeYAML converts mappings with non-string keys to map[string]interface{}
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	}
+	return value
+}
+
+// isYAMLContentType reports whether contentType is a YAML media type
+func isYAMLContentType(contentType string) bool {
+	mt := mediaType(contentType)
+	for _, ct := range yamlMediaTypes {
+		if mt == ct {
+			return true
+		}
+	}
+	return structuredSuffix(mt) == "+yaml"
+}
+
+// acceptsYAML reports whether template output may be converted to t from YAML
+func acceptsYAML(t reflect.Type) bool {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t != nil && (t.Kind() == reflect.Struct || t.Kind() == reflect.Map)
+}
+
+// yamlToType decodes YAML into target. The document is converted to JSON first
+// so that json struct tags apply the same way as for JSON output. Output that
+// starts like a JSON object or array is not retried as YAML, so malformed JSON
+// is still reported as an error.
+func yamlToType(s string, target interface{}) error {
+	if trimmed := strings.TrimSpace(s); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return fmt.Errorf("output is not valid JSON")
+	}
+	value, err := decodeYAML([]byte(s))
+	if err != nil {
+		return err
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return fmt.Errorf("YAML output is not a mapping")
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Test YAML bodies are decoded into BodyYAML and Parsed
+func TestExtractYAMLBody(t *testing.T) {
+	body := `
+service: billing
+replicas: 3
+ports:
+  - 80
+  - 443
+labels:
+  1: one
+`
+	data := extractRequest(t, Config{}, newBodyRequest("application/yaml", body))
+
+	if data.BodyYAML == nil {
+		t.Fatal("Expected BodyYAML to be parsed")
+	}
+	if data.BodyYAML["service"] != "billing" || data.BodyYAML["replicas"] != 3 {
+		t.Errorf("Unexpected YAML values: %v", data.BodyYAML)
+	}
+	if ports, ok := data.BodyYAML["ports"].([]interface{}); !ok || len(ports) != 2 {
+		t.Errorf("Expected ports sequence, got %v", data.BodyYAML["ports"])
+	}
+	// Non-string keys are converted so templates can index them
+	if labels, ok := data.BodyYAML["labels"].(map[string]interface{}); !ok || labels["1"] != "one" {
+		t.Errorf("Expected string-keyed labels, got %#v", data.BodyYAML["labels"])
+	}
+	if data.Parsed == nil {
+		t.Error("Expected Parsed to be set")
+	}
+
+	// Suffix and legacy media types are recognised
+	for _, contentType := range []string{"application/x-yaml", "text/yaml; charset=utf-8", "application/vnd.config+yaml"} {
+		if data := extractRequest(t, Config{}, newBodyRequest(contentType, "a: 1")); data.BodyYAML["a"] != 1 {
+			t.Errorf("%s: expected YAML to be decoded, got %v", contentType, data.BodyYAML)
+		}
+	}
+
+	// Invalid YAML is logged and ignored
+	if data := extractRequest(t, Config{}, newBodyRequest("application/yaml", "a: [1, 2")); data.BodyYAML != nil || data.Parsed != nil {
+		t.Errorf("Expected invalid YAML to be ignored, got %v", data.BodyYAML)
+	}
+}
+
+type yamlResult struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+// Test GenericParser accepts YAML output for structs and maps
+func TestGenericParserYAMLOutput(t *testing.T) {
+	p, err := NewGenericParser[yamlResult](Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer p.Close()
+
+	content := "name: {{index .Query \"name\" 0}}\ncount: 2\ntags:\n  - a\n  - b\n"
+	if err := p.UpdateTemplate("yaml", content); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/?name=widget", nil)
+	result, _, err := p.Parse("yaml", req)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if result.Name != "widget" || result.Count != 2 || len(result.Tags) != 2 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	// JSON output keeps working
+	if err := p.UpdateTemplate("json", `{"name":"json","count":1}`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if result, _, err := p.Parse("json", req); err != nil || result.Name != "json" {
+		t.Errorf("Expected JSON output to convert, got %+v (%v)", result, err)
+	}
+
+	// Output that is neither JSON nor a YAML mapping still fails
+	if err := p.UpdateTemplate("text", `just text`); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if _, _, err := p.Parse("text", req); err == nil || !strings.Contains(err.Error(), "cannot unmarshal") {
+		t.Errorf("Expected conversion error, got %v", err)
+	}
+
+	mapParser, err := NewGenericParser[map[string]interface{}](Config{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	defer mapParser.Close()
+	if err := mapParser.UpdateTemplate("yaml", "key: value"); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if result, _, err := mapParser.Parse("yaml", req); err != nil || result["key"] != "value" {
+		t.Errorf("Expected map from YAML output, got %v (%v)", result, err)
+	}
+}